@@ -0,0 +1,164 @@
+// Generates code for modules listed in a project config file (see codegen.ProjectConfig).
+//
+// Install:
+//
+//	$ go install github.com/function61/eventkit/cmd/eventkit-codegen
+//
+// Run in your project. relative paths in config, and the generated pkg/, frontend/ and docs/
+// directories, are relative to the config file's directory, not to the working directory:
+//
+//	$ eventkit-codegen
+//	$ eventkit-codegen -config path/to/codegen.json
+//
+// In CI, verify that generated files are up to date with the specs (exits non-zero if not):
+//
+//	$ eventkit-codegen -check
+//
+// Before merging spec changes, compare them to an old version (like a checkout of the main branch)
+// to find changes that break clients or reading of stored events (exits non-zero if found):
+//
+//	$ git worktree add /tmp/main main
+//	$ eventkit-codegen -compat-since /tmp/main/codegen.json
+//
+// Breaking changes made on purpose are acknowledged by listing them (as reported, one per line)
+// in a file:
+//
+//	$ eventkit-codegen -compat-since /tmp/main/codegen.json -acknowledged breaking-changes.txt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/function61/eventkit/codegen"
+)
+
+func main() {
+	configPath := flag.String("config", "codegen.json", "project config file")
+	check := flag.Bool("check", false, "only report (with diffs) generated files that are out of date")
+	compatSince := flag.String("compat-since", "", "project config file of an old version of the specs to report changes against")
+	acknowledgedPath := flag.String("acknowledged", "", "file listing breaking changes (as reported) that are made on purpose")
+	flag.Parse()
+
+	var err error
+	if *compatSince != "" {
+		err = runCompat(*compatSince, *configPath, *acknowledgedPath)
+	} else {
+		err = run(*configPath, *check)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(configPath string, check bool) error {
+	conf, err := codegen.LoadProjectConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	// so spec paths and generated files' paths resolve the same regardless of where we're run
+	if err := os.Chdir(filepath.Dir(configPath)); err != nil {
+		return err
+	}
+
+	opts := conf.Opts()
+	opts.CheckOnly = check
+
+	return codegen.ProcessModules(conf.ToModules(), opts)
+}
+
+func runCompat(oldConfigPath string, configPath string, acknowledgedPath string) error {
+	acknowledged := []string{}
+	if acknowledgedPath != "" {
+		var err error
+		acknowledged, err = readAcknowledged(acknowledgedPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	oldModules, err := loadModulesRelativeToConfig(oldConfigPath)
+	if err != nil {
+		return err
+	}
+
+	newModules, err := loadModulesRelativeToConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	changes, err := codegen.CompareModules(oldModules, newModules)
+	if err != nil {
+		return err
+	}
+
+	isAcknowledged := map[string]bool{}
+	for _, ack := range acknowledged {
+		isAcknowledged[ack] = true
+	}
+
+	// unacknowledged breaking changes are listed by the error
+	for _, change := range changes {
+		if !change.Breaking {
+			fmt.Println("compatible:   " + change.String())
+		} else if isAcknowledged[change.String()] {
+			fmt.Println("acknowledged: " + change.String())
+		}
+	}
+
+	return codegen.CheckBreakingChangesAcknowledged(changes, acknowledged)
+}
+
+// modules whose spec paths are made relative to current directory, so that two configs can be
+// loaded without changing directories
+func loadModulesRelativeToConfig(configPath string) ([]*codegen.Module, error) {
+	conf, err := codegen.LoadProjectConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	relativeToConfig := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+
+		return filepath.Join(filepath.Dir(configPath), path)
+	}
+
+	modules := conf.ToModules()
+	for _, mod := range modules {
+		mod.TypesFile = relativeToConfig(mod.TypesFile)
+		mod.EventsSpecFile = relativeToConfig(mod.EventsSpecFile)
+		mod.CommandsSpecFile = relativeToConfig(mod.CommandsSpecFile)
+		mod.UiRoutesFile = relativeToConfig(mod.UiRoutesFile)
+	}
+
+	return modules, nil
+}
+
+// one change per line. empty lines and lines starting with "#" are ignored
+func readAcknowledged(path string) ([]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	acknowledged := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		acknowledged = append(acknowledged, line)
+	}
+
+	return acknowledged, nil
+}
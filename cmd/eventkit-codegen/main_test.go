@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestRunFromOtherDirectory(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "eventkit-codegen")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(projectDir)
+
+	specsDir, err := ioutil.TempDir("", "eventkit-codegen-specs")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(specsDir)
+
+	write := func(path string, content string) {
+		assert.Assert(t, os.MkdirAll(filepath.Dir(path), 0755) == nil)
+		assert.Assert(t, ioutil.WriteFile(path, []byte(content), 0644) == nil)
+	}
+
+	types := `{ "types": [ { "name": "Person", "type": { "_": "object", "fields": { "Name": { "_": "string" } } } } ] }`
+
+	write(filepath.Join(projectDir, "specs/app/types.json"), types)
+	write(filepath.Join(specsDir, "types.json"), types) // outside of project, referred to by absolute path
+
+	write(filepath.Join(projectDir, "codegen.json"), `{
+	"backend_module_prefix": "example.com/proj/pkg/",
+	"frontend_module_prefix": "generated/",
+	"modules": [
+		{ "path": "app", "types": "specs/app/types.json" },
+		{ "path": "shared", "types": "`+filepath.ToSlash(filepath.Join(specsDir, "types.json"))+`" }
+	]
+}`)
+
+	wd, err := os.Getwd()
+	assert.Assert(t, err == nil)
+	defer func() { _ = os.Chdir(wd) }()
+
+	assert.Assert(t, os.Chdir(specsDir) == nil)
+
+	// compat mode resolves spec paths without changing directories
+	assert.Assert(t, runCompat(filepath.Join(projectDir, "codegen.json"), filepath.Join(projectDir, "codegen.json"), "") == nil)
+
+	assert.Assert(t, run(filepath.Join(projectDir, "codegen.json"), false) == nil)
+
+	// generated files go next to the config, not to the working directory
+	for _, generated := range []string{"pkg/app/types.gen.go", "pkg/shared/types.gen.go", "frontend/generated/app_types.ts"} {
+		_, err := os.Stat(filepath.Join(projectDir, generated))
+		assert.Assert(t, err == nil)
+	}
+
+	_, err = os.Stat(filepath.Join(specsDir, "pkg"))
+	assert.Assert(t, os.IsNotExist(err))
+}
@@ -0,0 +1,66 @@
+package codegen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// generated file whose content on disk differs from what would be generated
+type StaleFile struct {
+	Path string
+	Diff string // unified diff from content on disk to what would be generated
+}
+
+// returned by ProcessModules() in Opts.CheckOnly mode if any generated file is out of date
+type StaleFilesError struct {
+	Files []StaleFile
+}
+
+func (s *StaleFilesError) Error() string {
+	paths := []string{}
+	diffs := []string{}
+	for _, file := range s.Files {
+		paths = append(paths, "  "+file.Path)
+		diffs = append(diffs, file.Diff)
+	}
+
+	return fmt.Sprintf(
+		"%d generated file(s) out of date (re-run code generation):\n%s\n\n%s",
+		len(s.Files),
+		strings.Join(paths, "\n"),
+		strings.Join(diffs, ""))
+}
+
+// renders target in memory and compares to what's on disk, without writing anything
+func checkFile(target FileToGenerate, data interface{}, staleFiles *[]StaleFile) error {
+	templateContent, err := target.obtainTemplate()
+	if err != nil {
+		return err
+	}
+
+	rendered, err := renderTemplate(target.targetPath, data, templateContent)
+	if err != nil {
+		return err
+	}
+
+	onDiskName := "a/" + target.targetPath
+	onDisk, err := ioutil.ReadFile(target.targetPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		onDiskName = "/dev/null" // not generated yet
+	}
+
+	if diff := unifiedDiff(onDiskName, "b/"+target.targetPath, string(onDisk), string(rendered)); diff != "" {
+		*staleFiles = append(*staleFiles, StaleFile{
+			Path: target.targetPath,
+			Diff: diff,
+		})
+	}
+
+	return nil
+}
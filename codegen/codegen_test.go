@@ -1,12 +1,22 @@
 package codegen
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/function61/gokit/testing/assert"
 )
 
+func TestGoComment(t *testing.T) {
+	assert.EqualString(t, goComment("\t", "Grass\r\n\nsecond line"), "\t// Grass\n\t//\n\t// second line")
+}
+
 func TestBeginsWithUppercaseLetter(t *testing.T) {
 	mkDatatype := func(name string) *DatatypeDef {
 		return &DatatypeDef{NameRaw: name}
@@ -34,3 +44,780 @@ func TestFlattenDatatype(t *testing.T) {
 	assert.EqualString(t, flattened[1].NameRaw, "object")
 	assert.EqualString(t, flattened[2].NameRaw, "string")
 }
+
+func TestGoParamName(t *testing.T) {
+	assert.EqualString(t, goParamName("Name"), "name")
+	assert.EqualString(t, goParamName("ID"), "id")
+	assert.EqualString(t, goParamName("URLPath"), "urlPath")
+	assert.EqualString(t, goParamName("Type"), "typ")
+	assert.EqualString(t, goParamName("Func"), "funcArg")
+	assert.EqualString(t, goParamName("Ctx"), "ctxArg")
+	assert.EqualString(t, goParamName("already"), "already")
+}
+
+func TestEndpointGoPath(t *testing.T) {
+	endpoint := &EndpointDefinition{Path: "/users/{id}/search?q={query}"}
+
+	assert.EqualString(t, endpoint.GoPath(), `/users/"+pathEscape(id)+"/search?q="+queryEscape(query)+"`)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	assert.EqualString(t, unifiedDiff("a", "b", "same\n", "same\n"), "")
+
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	new := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n15\n16\n"
+
+	assert.EqualString(t, unifiedDiff("a/file", "b/file", old, new), `--- a/file
++++ b/file
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -11,5 +11,5 @@
+ 11
+ 12
+ 13
+-14
+ 15
++16
+`)
+
+	assert.EqualString(t, unifiedDiff("/dev/null", "b/file", "", "new\n"), `--- /dev/null
++++ b/file
+@@ -0,0 +1,1 @@
++new
+`)
+}
+
+func TestModuleValidate(t *testing.T) {
+	mod := NewModule("app/users", "types.json", "events.json", "commands.json", "")
+	mod.Types = &ApplicationTypesDefinition{
+		Enums: []EnumDef{
+			{Name: "Role", Type: "float", StringMembers: []string{"admin"}},
+		},
+		Endpoints: []EndpointDefinition{
+			{Name: "getUser", Path: "/users/{ctx}", HttpMethod: "GET", MiddlewareChain: "public"},
+		},
+	}
+	mod.Events = &DomainFile{
+		Events: []*EventSpec{
+			{
+				Event:    "user.Created",
+				CtorArgs: []string{"Name", "Age"},
+				Fields: []*EventFieldSpec{
+					{Key: "Name", Type: DatatypeDef{NameRaw: "string"}},
+					{Key: "Address", Type: DatatypeDef{NameRaw: "list", Of: &DatatypeDef{NameRaw: "Address"}}},
+				},
+			},
+		},
+	}
+	mod.Commands = &CommandSpecFile{
+		{
+			Command:         "user.Create",
+			MiddlewareChain: "authenticated",
+			CtorArgs:        []string{"Id"},
+			Fields: []*CommandFieldSpec{
+				{Key: "Name"},
+				{Key: "Name"},
+				{Key: "Role", Type: "Role"},
+			},
+		},
+		{
+			Command:         "user.Create",
+			MiddlewareChain: "authenticated",
+		},
+	}
+
+	assert.Assert(t, json.Unmarshal([]byte(`[
+	{ "id": "user", "path": "/users/{id}", "query_params": [
+		{ "key": "id", "type": { "_": "string" } },
+		{ "key": "Page", "type": { "_": "integer" } },
+		{ "key": "page", "type": { "_": "integer" } }
+	] }
+]`), &mod.UiRoutes) == nil)
+	mod.UiRoutesFile = "ui-routes.json"
+
+	err := mod.Validate()
+	assert.EqualString(t, err.Error(), `types.json: enum "Role": unsupported enum type "float" (supported: string, integer)
+types.json: endpoint "getUser": path placeholder "ctx" collides with generated client's identifier
+events.json: event "user.Created" field "Address" list item: undefined type "Address"
+events.json: event "user.Created": ctor arg "Age" has no matching field
+commands.json: command "user.Create" field "Name": defined more than once
+commands.json: command "user.Create": ctor arg "Id" has no matching field
+commands.json: command "user.Create": defined more than once
+ui-routes.json: route "user" query param "id": clashes with path placeholder "id"
+ui-routes.json: route "user" query param "page": clashes with query param "Page"`)
+
+	// defaults were filled in
+	assert.EqualString(t, (*mod.Commands)[0].Fields[0].Type, "text")
+}
+
+func TestCrossModuleTypes(t *testing.T) {
+	domain := NewModule("shared/domain", "", "", "", "")
+	domain.Types = &ApplicationTypesDefinition{
+		Enums: []EnumDef{
+			{Name: "Level", Type: "integer", Members: []EnumMemberDef{{Key: "basic", Value: float64(1)}}},
+		},
+		Types: []NamedDatatypeDef{
+			{Name: "Money", Type: &DatatypeDef{NameRaw: "integer"}},
+		},
+	}
+
+	mod := NewModule("app/users", "", "events.json", "commands.json", "")
+	mod.Types = &ApplicationTypesDefinition{}
+	mod.Events = &DomainFile{
+		Events: []*EventSpec{
+			{
+				Event: "user.Created",
+				Fields: []*EventFieldSpec{
+					{Key: "Budget", Type: DatatypeDef{NameRaw: "domain.Money"}},
+					{Key: "Tier", Type: DatatypeDef{NameRaw: "domain.Tier"}},
+					{Key: "Other", Type: DatatypeDef{NameRaw: "elsewhere.Thing"}}, // not part of this run
+				},
+			},
+		},
+	}
+	mod.Commands = &CommandSpecFile{
+		{
+			Command:         "user.Create",
+			MiddlewareChain: "authenticated",
+			Fields: []*CommandFieldSpec{
+				{Key: "Level", Type: "domain.Level"},
+				{Key: "Budget", Type: "domain.Money"},
+				{Key: "Tier", Type: "domain.Tier"},
+			},
+		},
+	}
+
+	modulesById := map[string]*Module{"domain": domain, "users": mod}
+	domain.otherModules = modulesById
+	mod.otherModules = modulesById
+
+	assert.EqualString(t, mod.Validate().Error(), `events.json: event "user.Created" field "Tier": undefined type "domain.Tier"
+commands.json: command "user.Create" field "Tier": undefined type "domain.Tier"`)
+
+	level := (*mod.Commands)[0].Fields[0]
+	assert.EqualString(t, level.AsGoType(mod), "domain.Level")
+	assert.EqualString(t, level.AsValidationSnippet(mod), `if x.Level == 0 {
+		return fieldEmptyValidationError("Level")
+	}
+	`)
+	assert.EqualString(t, (*mod.Commands)[0].Fields[1].AsGoType(mod), "*domain.Money")
+
+	assert.EqualString(t, mod.ImportedModulePath("domain"), "shared/domain")
+	assert.EqualString(t, mod.ImportedModulePath("elsewhere"), "elsewhere")
+}
+
+func TestSpecErrorPositions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "codegen-test")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(dir)
+
+	commandsFile := filepath.Join(dir, "commands.json")
+
+	writeAndProcess := func(content string) string {
+		assert.Assert(t, ioutil.WriteFile(commandsFile, []byte(content), 0644) == nil)
+
+		return ProcessModules([]*Module{NewModule("app/users", "", "", commandsFile, "")}, Opts{}).Error()
+	}
+
+	assert.EqualString(t, writeAndProcess(`[
+	{
+		"command": "user.Create",
+		"chain": "authenticated",
+		"fields": [
+			{ "key": "Name", "max_lenght": 10 }
+		]
+	}
+]`), commandsFile+`:6:21: json: unknown field "max_lenght"`)
+
+	assert.EqualString(t, writeAndProcess(`[
+	{
+		"command": "user.Create",
+		"chain": "authenticated",
+		"ctor": ["Name", "Email"],
+		"fields": [
+			{ "key": "Name", "type": "Person" }
+		]
+	},
+	{ "command": "user.Create", "chain": "authenticated" }
+]`), commandsFile+`:7:21: command "user.Create" field "Name": undefined type "Person"
+`+commandsFile+`:5:20: command "user.Create": ctor arg "Email" has no matching field
+`+commandsFile+`:10:2: command "user.Create": defined more than once`)
+
+	uiRoutesFile := filepath.Join(dir, "ui-routes.json")
+	assert.Assert(t, ioutil.WriteFile(uiRoutesFile, []byte(`[
+	{ "id": "users", "path": "/users/{1st}", "query_params": [
+		{ "key": "sort-by", "type": { "_": "string" } }
+	] }
+]`), 0644) == nil)
+
+	assert.EqualString(t, ProcessModules([]*Module{NewModule("app/users", "", "", "", uiRoutesFile)}, Opts{}).Error(), uiRoutesFile+`:2:19: route "users": path placeholder "1st" is not a valid identifier
+`+uiRoutesFile+`:3:5: route "users" query param "sort-by": key is not a valid identifier (letters, digits and underscores, not starting with a digit)`)
+
+	assert.EqualString(t, writeAndProcess(`[
+	{ "command": "user.Create" ]`), commandsFile+`:2:29: invalid character ']' after object key:value pair`)
+}
+
+func TestCommandFieldTypes(t *testing.T) {
+	mod := NewModule("app/users", "", "", "", "")
+	mod.Types = &ApplicationTypesDefinition{}
+
+	goAndTsType := func(field CommandFieldSpec) string {
+		return field.AsGoType(mod) + " | " + field.AsTsType()
+	}
+
+	assert.EqualString(t, goAndTsType(CommandFieldSpec{Type: "datetime"}), "time.Time | datetimeRFC3339")
+	assert.EqualString(t, goAndTsType(CommandFieldSpec{Type: "email"}), "string | string")
+	assert.EqualString(t, goAndTsType(CommandFieldSpec{Type: "list", ListOf: "integer"}), "[]int | number[]")
+	assert.EqualString(t, goAndTsType(CommandFieldSpec{Type: "list", ListOf: "uuid"}), "[]string | string[]")
+	assert.EqualString(t, goAndTsType(CommandFieldSpec{Type: "list", ListOf: "checkbox"}), " | ")
+}
+
+func TestIntegerConstraintsValidationSnippet(t *testing.T) {
+	mod := NewModule("app/users", "", "", "", "")
+	mod.Types = &ApplicationTypesDefinition{}
+
+	min := float64(10)
+	step := float64(5)
+
+	field := &CommandFieldSpec{Key: "Age", Type: "integer", Min: &min, Step: &step}
+
+	assert.EqualString(t, field.AsValidationSnippet(mod), `if x.Age < 10 {
+		return fieldRangeValidationError("Age", "at least 10", x.Age)
+	}
+	if (x.Age-10)%5 != 0 {
+		return fieldRangeValidationError("Age", "10 plus a multiple of 5", x.Age)
+	}`)
+
+	// integers always satisfy step 1
+	one := float64(1)
+	field = &CommandFieldSpec{Key: "Age", Type: "integer", Min: &min, Step: &one}
+
+	assert.EqualString(t, field.AsValidationSnippet(mod), `if x.Age < 10 {
+		return fieldRangeValidationError("Age", "at least 10", x.Age)
+	}`)
+	assert.EqualString(t, field.AsTsValidationSnippet(mod), `{
+		const value = valueOr(x.Age, 0);
+		if (value < 10) {
+			return fieldRangeValidationError('Age', 'at least 10', value);
+		}
+	}`)
+
+	// min_items covers the empty check
+	minItems := 2
+	field = &CommandFieldSpec{Key: "Tags", Type: "list", ListOf: "integer", MinItems: &minItems}
+
+	assert.EqualString(t, field.AsValidationSnippet(mod), `if len(x.Tags) < 2 {
+		return fieldItemCountValidationError("Tags", "at least 2", len(x.Tags))
+	}`)
+	assert.EqualString(t, field.AsTsValidationSnippet(mod), `{
+		const value = valueOr(x.Tags, []);
+		if (value.length < 2) {
+			return fieldItemCountValidationError('Tags', 'at least 2', value.length);
+		}
+	}`)
+}
+
+func TestTsValidationSnippet(t *testing.T) {
+	mod := NewModule("app/users", "", "", "", "")
+	mod.Types = &ApplicationTypesDefinition{}
+
+	min := float64(10)
+	step := float64(5)
+
+	field := &CommandFieldSpec{Key: "Age", Type: "integer", Min: &min, Step: &step, Default: float64(20)}
+
+	assert.EqualString(t, field.AsTsValidationSnippet(mod), `{
+		const value = valueOr(x.Age, 20);
+		if (value < 10) {
+			return fieldRangeValidationError('Age', 'at least 10', value);
+		}
+		if ((value - 10) % 5 !== 0) {
+			return fieldRangeValidationError('Age', '10 plus a multiple of 5', value);
+		}
+	}`)
+
+	field = &CommandFieldSpec{Key: "Bio", Type: "multiline", Optional: true}
+
+	assert.EqualString(t, field.AsTsValidationSnippet(mod), `{
+		const value = valueOr(x.Bio, '');
+		if (byteLength(value) > 4096) {
+			return fieldLengthValidationError('Bio', 4096, byteLength(value));
+		}
+	}`)
+
+	assert.EqualString(t, (&CommandFieldSpec{Key: "Admin", Type: "checkbox"}).AsTsValidationSnippet(mod), "")
+}
+
+func TestDeprecation(t *testing.T) {
+	parse := func(spec string) Deprecation {
+		field := CommandFieldSpec{}
+		assert.Assert(t, json.Unmarshal([]byte(spec), &field) == nil)
+		return field.Deprecated
+	}
+
+	assert.Assert(t, !parse(`{"key": "Name"}`).IsDeprecated)
+	assert.Assert(t, !parse(`{"deprecated": false}`).IsDeprecated)
+	assert.EqualString(t, parse(`{"deprecated": true}`).Message(), "Scheduled for removal.")
+	assert.EqualString(t, parse(`{"deprecated": {"replacement": "FullName"}}`).Message(), "Use FullName instead.")
+	assert.EqualString(t, parse(`{"deprecated": {"reason": "Ambiguous.", "replacement": "FullName"}}`).TsDoc(), "/** @deprecated Ambiguous. Use FullName instead. */")
+	assert.EqualString(t, parse(`{"deprecated": {"reason": "Confuses */ JSDoc\nand comments"}}`).TsDoc(), `/** @deprecated Confuses *\/ JSDoc and comments. */`)
+
+	assert.EqualString(t, json.Unmarshal([]byte(`{"deprecated": {"reson": "typo"}}`), &CommandFieldSpec{}).Error(), `json: unknown field "reson"`)
+}
+
+func TestProcessEnums(t *testing.T) {
+	defs := []EnumDef{
+		{
+			Name: "Priority",
+			Type: "integer",
+			Members: []EnumMemberDef{
+				{Key: "low", Value: float64(1), Label: "Low"},
+				{Key: "very_high", Value: float64(10), Deprecated: Deprecation{IsDeprecated: true}},
+			},
+		},
+		{
+			Name:          "Color",
+			Type:          "string",
+			Members:       []EnumMemberDef{{Value: "red", Description: "Like blood"}},
+			StringMembers: []string{"dark_blue"},
+		},
+	}
+
+	enums := ProcessEnums(defs)
+
+	assert.Assert(t, len(enums) == 2)
+
+	priority := enums[0]
+	assert.Assert(t, priority.Integer)
+	assert.EqualString(t, priority.Members[0].GoKey, "PriorityLow")
+	assert.EqualString(t, priority.Members[0].GoValue, "1")
+	assert.EqualString(t, priority.Members[0].Label, "Low")
+	assert.EqualString(t, priority.Members[1].SpecKey, "very_high")
+	assert.EqualString(t, priority.Members[1].GoKey, "PriorityVeryHigh")
+	assert.EqualString(t, priority.Members[1].Label, "very_high")
+	assert.Assert(t, priority.Members[1].Deprecated.IsDeprecated)
+
+	color := enums[1]
+	assert.Assert(t, !color.Integer)
+	assert.EqualString(t, color.Members[0].GoValue, "red")
+	assert.EqualString(t, color.Members[0].Description, "Like blood")
+	assert.EqualString(t, color.Members[1].GoKey, "ColorDarkBlue")
+	assert.EqualString(t, color.Members[1].GoValue, "dark_blue")
+
+	// deprecated API sees only the string-backed ones
+	stringEnums := ProcessStringEnums(defs)
+	assert.Assert(t, len(stringEnums) == 1)
+	assert.EqualString(t, stringEnums[0].Name, "Color")
+	assert.EqualString(t, stringEnums[0].MembersDigest, color.MembersDigest)
+}
+
+func TestCommandFieldDefaults(t *testing.T) {
+	mod := NewModule("app/users", "", "", "", "")
+	mod.Types = &ApplicationTypesDefinition{
+		Enums: []EnumDef{
+			{Name: "Priority", Type: "integer", Members: []EnumMemberDef{{Key: "low", Value: float64(1)}}},
+		},
+	}
+
+	cmd := &CommandSpec{
+		Fields: []*CommandFieldSpec{
+			{Key: "Name", Type: "text", Default: "Joe"},
+			{Key: "Age", Type: "integer"},
+			{Key: "Prio", Type: "Priority", Default: float64(1)},
+			{Key: "Tags", Type: "list", ListOf: "integer", Default: []interface{}{float64(1), float64(2)}},
+		},
+	}
+
+	assert.EqualString(t, cmd.GoDefaults(mod), `Name: "Joe", Prio: Priority(1), Tags: []int{1, 2}`)
+
+	_, err := (&CommandFieldSpec{Key: "Prio", Type: "Priority", Default: float64(3)}).goDefaultLiteral(mod)
+	assert.EqualString(t, err.Error(), "default 3 is not a member of Priority")
+
+	_, err = (&CommandFieldSpec{Key: "Age", Type: "integer", Default: "18"}).goDefaultLiteral(mod)
+	assert.EqualString(t, err.Error(), "default must be a whole number")
+}
+
+func TestEventTsSchemas(t *testing.T) {
+	mod := NewModule("app/users", "", "", "", "")
+	mod.Types = &ApplicationTypesDefinition{
+		Enums: []EnumDef{
+			{Name: "Color", Type: "string", StringMembers: []string{"red", "blue"}},
+		},
+		Types: []NamedDatatypeDef{
+			{Name: "Address", Type: &DatatypeDef{NameRaw: "object", Fields: map[string]*DatatypeDef{
+				"Street": {NameRaw: "string"},
+				"Owner":  {NameRaw: "Person", Nullable: true},
+			}}},
+			{Name: "Person", Type: &DatatypeDef{NameRaw: "object", Fields: map[string]*DatatypeDef{
+				"Name": {NameRaw: "string"},
+			}}},
+		},
+	}
+
+	events := &DomainFile{
+		Events: []*EventSpec{
+			{
+				Event: "user.Moved",
+				Fields: []*EventFieldSpec{
+					{Key: "Id", Type: DatatypeDef{NameRaw: "string"}},
+					{Key: "Addresses", Type: DatatypeDef{NameRaw: "list", Of: &DatatypeDef{NameRaw: "Address"}}},
+					{Key: "Color", Type: DatatypeDef{NameRaw: "Color"}},
+					{Key: "Manager", Type: DatatypeDef{NameRaw: "hr.Employee"}},
+				},
+			},
+		},
+	}
+
+	assert.EqualString(t, events.Events[0].TsPayloadSchema(mod), "{ kind: 'object', fields: { Addresses: { kind: 'list', of: { kind: 'ref', ref: 'Address' } }, Color: { kind: 'oneOf', values: ['red', 'blue'] }, Id: { kind: 'string' }, Manager: { kind: 'any' } } }")
+
+	// Person is referenced only via Address
+	assert.EqualString(t, events.TsNamedTypeSchemas(mod), `	Address: { kind: 'object', fields: { Owner: { kind: 'nullable', of: { kind: 'ref', ref: 'Person' } }, Street: { kind: 'string' } } },
+	Person: { kind: 'object', fields: { Name: { kind: 'string' } } },`)
+
+	assert.EqualString(t, strings.Join(events.TsImportedCustomTypes(), ","), "Address,Color")
+}
+
+func TestCompareModules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "codegen-test")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(dir)
+
+	mkModule := func(version string, types string, events string, commands string, uiRoutes string) *Module {
+		write := func(name string, content string) string {
+			path := filepath.Join(dir, version+"-"+name)
+			assert.Assert(t, ioutil.WriteFile(path, []byte(content), 0644) == nil)
+			return path
+		}
+
+		return NewModule(
+			"app/users",
+			write("types.json", types),
+			write("events.json", events),
+			write("commands.json", commands),
+			write("ui-routes.json", uiRoutes))
+	}
+
+	oldMod := mkModule("old", `{
+	"enums": [
+		{ "name": "Color", "type": "string", "stringMembers": ["red", "blue"] }
+	],
+	"endpoints": [
+		{ "name": "getUser", "path": "/users/{id}", "method": "GET", "chain": "authenticated", "produces": { "_": "User" } },
+		{ "name": "patchUser", "path": "/users/{id}", "method": "PATCH", "chain": "authenticated", "consumes": { "_": "list", "of": { "_": "UserPatch" } } },
+		{ "name": "updateUser", "path": "/users/{id}", "method": "PUT", "chain": "authenticated", "consumes": { "_": "object", "fields": {
+			"Name": { "_": "string" }, "Legacy": { "_": "string" }, "Bio": { "_": "string", "nullable": true }
+		} } }
+	],
+	"types": [
+		{ "name": "User", "type": { "_": "object", "fields": { "Name": { "_": "string" }, "Age": { "_": "integer" } } } },
+		{ "name": "UserPatch", "type": { "_": "object", "fields": { "Name": { "_": "string" } } } }
+	]
+}`, `{
+	"events": [
+		{ "event": "user.Created", "fields": [ { "key": "Id", "type": { "_": "string" } } ] },
+		{ "event": "user.Deleted", "fields": [] }
+	]
+}`, `[
+	{ "command": "user.Create", "chain": "authenticated", "fields": [
+		{ "key": "Name", "max_length": 100 },
+		{ "key": "Nick", "optional": true }
+	] },
+	{ "command": "user.Delete", "chain": "authenticated", "fields": [] }
+]`, `[
+	{ "id": "user", "path": "/users/{id}", "query_params": [
+		{ "key": "tab", "type": { "_": "string" } },
+		{ "key": "page", "type": { "_": "integer", "nullable": true } },
+		{ "key": "q", "type": { "_": "string", "nullable": true } }
+	] },
+	{ "id": "settings", "path": "/settings" }
+]`)
+
+	newMod := mkModule("new", `{
+	"enums": [
+		{ "name": "Color", "type": "string", "stringMembers": ["blue", "green"] }
+	],
+	"endpoints": [
+		{ "name": "getUser", "path": "/user/{id}", "method": "POST", "chain": "authenticated", "produces": { "_": "User" } },
+		{ "name": "patchUser", "path": "/users/{id}", "method": "PATCH", "chain": "authenticated", "consumes": { "_": "list", "of": { "_": "UserPatch" } } },
+		{ "name": "updateUser", "path": "/users/{id}", "method": "PUT", "chain": "authenticated", "consumes": { "_": "object", "fields": {
+			"Name": { "_": "string", "nullable": true }, "Bio": { "_": "string" }, "Email": { "_": "string" }, "Nick": { "_": "string", "nullable": true }
+		} } }
+	],
+	"types": [
+		{ "name": "User", "type": { "_": "object", "fields": { "Name": { "_": "string" }, "Email": { "_": "string" } } } },
+		{ "name": "UserPatch", "type": { "_": "object", "fields": { "Name": { "_": "string" }, "Phone": { "_": "string" } } } }
+	]
+}`, `{
+	"events": [
+		{ "event": "user.Created", "fields": [
+			{ "key": "Id", "type": { "_": "integer" } },
+			{ "key": "Color", "type": { "_": "Color", "nullable": true } }
+		] }
+	]
+}`, `[
+	{ "command": "user.Create", "chain": "authenticated", "fields": [
+		{ "key": "Name", "max_length": 50 },
+		{ "key": "Nick" },
+		{ "key": "Email", "optional": true }
+	] },
+	{ "command": "user.Rename", "chain": "authenticated", "fields": [] }
+]`, `[
+	{ "id": "user", "path": "/users/{userId}", "query_params": [
+		{ "key": "page", "type": { "_": "integer" } },
+		{ "key": "sort", "type": { "_": "string", "nullable": true } },
+		{ "key": "lang", "type": { "_": "string" } }
+	] },
+	{ "id": "search", "path": "/search" }
+]`)
+
+	changes, err := CompareModules([]*Module{oldMod}, []*Module{newMod})
+	assert.Assert(t, err == nil)
+
+	report := []string{}
+	for _, change := range changes {
+		kind := "compatible"
+		if change.Breaking {
+			kind = "breaking"
+		}
+
+		report = append(report, kind+" "+change.String())
+	}
+
+	assert.EqualString(t, strings.Join(report, "\n"), `breaking app/users: enum "Color": member "red" removed (changes MembersDigest)
+compatible app/users: enum "Color": member "green" added (changes MembersDigest)
+breaking app/users: type "User" field "Age": removed
+compatible app/users: type "User" field "Email": added
+breaking app/users: type "UserPatch" field "Phone": added as non-nullable (old data doesn't have it)
+breaking app/users: endpoint "getUser": path changed from "/users/{id}" to "/user/{id}"
+breaking app/users: endpoint "getUser": method changed from GET to POST
+breaking app/users: endpoint "updateUser" consumes field "Bio": became non-nullable
+compatible app/users: endpoint "updateUser" consumes field "Legacy": removed
+compatible app/users: endpoint "updateUser" consumes field "Name": became nullable
+breaking app/users: endpoint "updateUser" consumes field "Email": added as non-nullable (old data doesn't have it)
+compatible app/users: endpoint "updateUser" consumes field "Nick": added
+breaking app/users: event "user.Created" field "Id": type changed from string to integer
+compatible app/users: event "user.Created" field "Color": added
+breaking app/users: event "user.Deleted": removed (stored events of this type could no longer be read)
+breaking app/users: command "user.Create" field "Name": max_length tightened from 100 to 50
+breaking app/users: command "user.Create" field "Nick": became required
+compatible app/users: command "user.Create" field "Email": added
+breaking app/users: command "user.Delete": removed
+compatible app/users: command "user.Rename": added
+breaking app/users: route "user" query param "tab": removed (old URLs always carry it)
+breaking app/users: route "user" query param "page": became required
+compatible app/users: route "user" query param "q": removed
+compatible app/users: route "user" query param "sort": added
+breaking app/users: route "user" query param "lang": added as required
+breaking app/users: route "settings": removed
+compatible app/users: route "search": added`)
+
+	acknowledgeAllBut := func(except string) []string {
+		acknowledged := []string{}
+		for _, change := range changes {
+			if change.Breaking && change.String() != except {
+				acknowledged = append(acknowledged, change.String())
+			}
+		}
+
+		return acknowledged
+	}
+
+	assert.Assert(t, CheckBreakingChangesAcknowledged(changes, acknowledgeAllBut("")) == nil)
+
+	assert.EqualString(t, CheckBreakingChangesAcknowledged(changes, acknowledgeAllBut(`app/users: command "user.Delete": removed`)).Error(), `1 breaking change(s) not acknowledged:
+  app/users: command "user.Delete": removed`)
+
+	invalidMod := mkModule("invalid", `{}`, `{}`, `[ { "command": "user.Create" } ]`, `[]`)
+
+	_, err = CompareModules([]*Module{oldMod}, []*Module{invalidMod})
+	assert.Assert(t, strings.HasPrefix(err.Error(), "new version: "))
+}
+
+func TestUiRouteGoHelpers(t *testing.T) {
+	routes := []uiRouteSpec{}
+	assert.Assert(t, json.Unmarshal([]byte(`[
+	{ "id": "home", "path": "/" },
+	{ "id": "invoice", "path": "/accounts/{account}/invoices/{id}.pdf", "query_params": [
+		{ "key": "lang", "type": { "_": "string", "nullable": true } },
+		{ "key": "page", "type": { "_": "integer" } }
+	] }
+]`), &routes) == nil)
+
+	home := routes[0]
+	invoice := routes[1]
+
+	assert.EqualString(t, home.GoPath(), `"/"`)
+	assert.EqualString(t, home.PathReGo(), `"^/$"`)
+
+	assert.EqualString(t, invoice.GoName(), "Invoice")
+	assert.EqualString(t, invoice.GoPath(), `"/accounts/"+url.PathEscape(opts.Account)+"/invoices/"+url.PathEscape(opts.Id)+".pdf"`)
+	assert.EqualString(t, invoice.PathReGo(), `"^/accounts/([^/]+)/invoices/([^/]+)\\.pdf$"`)
+
+	fields := []string{}
+	for _, param := range append(invoice.GoPathParams(), invoice.GoQueryParams()...) {
+		fields = append(fields, param.GoField+" "+param.GoType)
+	}
+
+	assert.EqualString(t, strings.Join(fields, ", "), "Account string, Id string, Lang *string, Page int")
+}
+
+func TestGeneratedCode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles generated code")
+	}
+
+	goBinary, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	// inside this module, so that the generated code can import eventkit's packages
+	dir, err := ioutil.TempDir(".", "_generated")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(dir)
+
+	write := func(path string, content string) {
+		assert.Assert(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755) == nil)
+		assert.Assert(t, ioutil.WriteFile(filepath.Join(dir, path), []byte(content), 0644) == nil)
+	}
+
+	// multi-line texts must stay inside comments
+	write("types.json", `{
+	"enums": [
+		{ "name": "Priority", "type": "integer", "members": [
+			{ "key": "low", "value": 1, "description": "Whenever.\nNo rush." },
+			{ "key": "high", "value": 2, "deprecated": { "reason": "Everything\nis high" } }
+		] },
+		{ "name": "Color", "type": "string", "members": [
+			{ "value": "green", "description": "Grass\nsecond line" }
+		] }
+	]
+}`)
+
+	write("commands.json", `[
+	{
+		"command": "user.Create",
+		"crudNature": "create",
+		"chain": "authenticated",
+		"ctor": ["Name"],
+		"fields": [
+			{ "key": "Name" },
+			{ "key": "Age", "type": "integer", "default": 18 },
+			{ "key": "Nickname", "optional": true },
+			{ "key": "Agree", "type": "checkbox", "default": true }
+		]
+	}
+]`)
+
+	// exercises the generated client against a server that records the payload
+	write("pkg/app/client_test.go", `package app
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/function61/eventkit/httpcommandclient"
+)
+
+func TestClient(t *testing.T) {
+	payloads := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := ioutil.ReadAll(r.Body)
+		payloads = append(payloads, string(payload))
+		w.Header().Set("x-created-record-id", "123")
+	}))
+	defer server.Close()
+
+	client := NewCommandClient(httpcommandclient.New(server.URL+"/command/", "", nil))
+
+	age := 30
+	id, err := client.UserCreate(context.Background(), "Joe", UserCreateOpts{Age: &age})
+	if err != nil || id != "123" {
+		t.Fatalf("id=%s err=%v", id, err)
+	}
+
+	if _, err := client.UserCreate(context.Background(), "", UserCreateOpts{}); err == nil {
+		t.Fatal("expected client-side validation error")
+	}
+
+	// unset fields are left for the server to default
+	if len(payloads) != 1 || payloads[0] != `+"`"+`{"Age":30,"Name":"Joe"}`+"`"+` {
+		t.Fatalf("unexpected payloads: %v", payloads)
+	}
+}
+`)
+
+	wd, err := os.Getwd()
+	assert.Assert(t, err == nil)
+	assert.Assert(t, os.Chdir(dir) == nil)
+	defer func() { _ = os.Chdir(wd) }()
+
+	assert.Assert(t, ProcessModules([]*Module{NewModule("app", "types.json", "", "commands.json", "")}, Opts{}) == nil)
+
+	output, err := exec.Command(goBinary, "test", "./pkg/app/").CombinedOutput()
+	if err != nil {
+		t.Fatalf("generated code: %v\n%s", err, output)
+	}
+}
+
+func TestProjectConfig(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "codegen")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(tempDir)
+
+	load := func(content string) (*ProjectConfig, error) {
+		path := filepath.Join(tempDir, "codegen.json")
+		assert.Assert(t, ioutil.WriteFile(path, []byte(content), 0644) == nil)
+		return LoadProjectConfig(path)
+	}
+
+	conf, err := load(`{
+	"backend_module_prefix": "github.com/myorg/myproject/pkg/",
+	"frontend_module_prefix": "generated/",
+	"no_gorilla_mux": true,
+	"modules": [
+		{ "path": "shared/domain", "types": "domain/types.json" },
+		{ "path": "app", "commands": "app/commands.json", "ui_routes": "app/ui-routes.json" }
+	]
+}`)
+	assert.Assert(t, err == nil)
+	assert.EqualString(t, conf.Opts().BackendModulePrefix, "github.com/myorg/myproject/pkg/")
+	assert.Assert(t, conf.Opts().NoGorillaMux)
+
+	modules := conf.ToModules()
+	assert.Assert(t, len(modules) == 2)
+	assert.EqualString(t, modules[0].Id, "domain")
+	assert.EqualString(t, modules[0].Path, "shared/domain")
+	assert.EqualString(t, modules[0].TypesFile, "domain/types.json")
+	assert.EqualString(t, modules[1].Id, "app")
+	assert.EqualString(t, modules[1].CommandsSpecFile, "app/commands.json")
+	assert.EqualString(t, modules[1].UiRoutesFile, "app/ui-routes.json")
+
+	_, err = load(`{ "modules": [ { "path": "app", "typos": "types.json" } ] }`)
+	assert.Assert(t, strings.Contains(err.Error(), `unknown field "typos"`))
+
+	_, err = load(`{ "modules": [] }`)
+	assert.EqualString(t, err.Error(), filepath.Join(tempDir, "codegen.json")+": no modules defined")
+
+	invalid := func(modules ...ProjectConfigModule) string {
+		return (&ProjectConfig{Modules: modules}).Validate().Error()
+	}
+
+	assert.EqualString(t, invalid(ProjectConfigModule{Types: "types.json"}), "modules[0]: path empty")
+	assert.EqualString(t, invalid(ProjectConfigModule{Path: "app/", Types: "types.json"}), "module app/: path must end with module name")
+	assert.EqualString(t, invalid(ProjectConfigModule{Path: "app"}), "module app: no spec files")
+	assert.EqualString(t, invalid(
+		ProjectConfigModule{Path: "billing/types", Types: "billing.json"},
+		ProjectConfigModule{Path: "users/types", Types: "users.json"},
+	), `module users/types: ID "types" already used by module billing/types`)
+}
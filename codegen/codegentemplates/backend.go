@@ -5,13 +5,15 @@ const BackendCommandsDefinitions = `package {{.Module.Id}}
 // WARNING: generated file
 
 import (
-	"errors"
 	"fmt"
+	"math/big"
 	"regexp"
 	"strings"
 	"github.com/function61/eventkit/command"
-{{if .CommandsImports.Date}}	"github.com/function61/eventkit/guts"{{end}}
-)
+{{if .CommandsImports.DateTime}}	"time"
+{{end}}{{if .CommandsImports.Date}}	"github.com/function61/eventkit/guts"
+{{end}}{{range .CommandsImports.ModuleIds}}	"{{$.Opts.BackendModulePrefix}}{{$.Module.ImportedModulePath .}}"
+{{end}})
 
 // handlers
 
@@ -41,8 +43,10 @@ func (i *invoker) Invoke(cmdGeneric command.Command, ctx *command.Ctx) error {
 
 // structs
 
-{{range .Module.Commands}}
-type {{.AsGoStructName}} struct { {{range .Fields}}
+{{range .Module.Commands}}{{with .Deprecated.Message}}
+// Deprecated: {{.}}{{end}}
+type {{.AsGoStructName}} struct { {{range .Fields}}{{with .Deprecated.Message}}
+	// Deprecated: {{.}}{{end}}
 	{{.Key}} {{.AsGoType $.Module}} ` + "`json:\"{{.Key}}\"`" + `{{end}}
 }
 
@@ -53,21 +57,31 @@ func (x *{{.AsGoStructName}}) Validate() error {
 }
 
 func (x *{{.AsGoStructName}}) MiddlewareChain() string { return "{{.MiddlewareChain}}" }
-func (x *{{.AsGoStructName}}) Key() string { return "{{.Command}}" }
+func (x *{{.AsGoStructName}}) Key() string { return "{{.Command}}" }{{if .Deprecated.IsDeprecated}}
+func (x *{{.AsGoStructName}}) Deprecation() string { return {{printf "%q" .Deprecated.Message}} }{{end}}
 {{end}}
 
-// allocators
+// allocators. they pre-fill fields' defaults, so they stay in effect if missing from JSON
 
 var Allocators = command.Allocators{
 {{range .Module.Commands}}
-	"{{.Command}}": func() command.Command { return &{{.AsGoStructName}}{} },{{end}}
+	"{{.Command}}": func() command.Command { return &{{.AsGoStructName}}{ {{- .GoDefaults $.Module -}} } },{{end}}
 }
 
-// util functions
+// util functions. error codes must match those of the generated TypeScript validators
 
 func regexpValidation(fieldName string, pattern string, content string) error {
 	if !regexp.MustCompile(pattern).MatchString(content) {
-		return fmt.Errorf("field %s does not match pattern %s", fieldName, pattern)
+		return fieldValidationError(fieldName, "field_pattern_mismatch", fmt.Sprintf("field %s does not match pattern %s", fieldName, pattern))
+	}
+
+	return nil
+}
+
+// format is "email" | "url" | ... empty content is not validated (presence is validated separately)
+func formatValidation(fieldName string, format string, pattern string, content string) error {
+	if content != "" && !regexp.MustCompile(pattern).MatchString(content) {
+		return fieldValidationError(fieldName, "field_invalid_format", fmt.Sprintf("field %s is not a valid %s", fieldName, format))
 	}
 
 	return nil
@@ -75,18 +89,80 @@ func regexpValidation(fieldName string, pattern string, content string) error {
 
 func noNewlinesValidation(fieldName string, content string) error {
 	if strings.ContainsAny(content, "\r\n") {
-		return errors.New("single-line field " + fieldName + " contains newlines")
+		return fieldValidationError(fieldName, "field_contains_newlines", "single-line field "+fieldName+" contains newlines")
 	}
 
 	return nil
 }
 
 func fieldEmptyValidationError(fieldName string) error {
-	return errors.New("field " + fieldName + " cannot be empty")
+	return fieldValidationError(fieldName, "field_empty", "field "+fieldName+" cannot be empty")
 }
 
 func fieldLengthValidationError(fieldName string, maxLength int, got int) error {
-	return fmt.Errorf("field %s exceeded maximum length %d (got %d)", fieldName, maxLength, got)
+	return fieldValidationError(fieldName, "field_too_long", fmt.Sprintf("field %s exceeded maximum length %d (got %d)", fieldName, maxLength, got))
+}
+
+func fieldMinLengthValidationError(fieldName string, minLength int, got int) error {
+	return fieldValidationError(fieldName, "field_too_short", fmt.Sprintf("field %s is shorter than minimum length %d (got %d)", fieldName, minLength, got))
+}
+
+// constraint is like "at least 10"
+func fieldRangeValidationError(fieldName string, constraint string, got interface{}) error {
+	return fieldValidationError(fieldName, "field_out_of_range", fmt.Sprintf("field %s must be %s (got %v)", fieldName, constraint, got))
+}
+
+// constraint is like "at least 10"
+func fieldItemCountValidationError(fieldName string, constraint string, got int) error {
+	return fieldValidationError(fieldName, "field_item_count", fmt.Sprintf("field %s must have %s items (got %d)", fieldName, constraint, got))
+}
+
+func fieldValidationError(fieldName string, code string, message string) error {
+	return &command.ValidationError{Field: fieldName, Code: code, Message: message}
+}
+
+// min, max and step are "" if not set. exact arithmetic, so steps like 0.01 work
+func decimalRangeValidation(fieldName string, content string, min string, max string, step string) error {
+	if content == "" { // presence is validated separately
+		return nil
+	}
+
+	value, ok := new(big.Rat).SetString(content)
+	if !ok {
+		return fieldValidationError(fieldName, "field_invalid_format", fmt.Sprintf("field %s is not a valid decimal", fieldName))
+	}
+
+	base := new(big.Rat)
+	if min != "" {
+		base.SetString(min)
+
+		if value.Cmp(base) < 0 {
+			return fieldRangeValidationError(fieldName, "at least "+min, content)
+		}
+	}
+
+	if max != "" {
+		maxRat, _ := new(big.Rat).SetString(max)
+
+		if value.Cmp(maxRat) > 0 {
+			return fieldRangeValidationError(fieldName, "at most "+max, content)
+		}
+	}
+
+	if step != "" {
+		stepRat, _ := new(big.Rat).SetString(step)
+
+		if !new(big.Rat).Quo(new(big.Rat).Sub(value, base), stepRat).IsInt() {
+			constraint := "a multiple of " + step
+			if min != "" && base.Sign() != 0 {
+				constraint = min + " plus " + constraint
+			}
+
+			return fieldRangeValidationError(fieldName, constraint, content)
+		}
+	}
+
+	return nil
 }
 `
 
@@ -95,6 +171,7 @@ const BackendEventDefinitions = `package {{.Module.Id}}
 import (
 {{if .EventsImports.DateTime}}	"time"
 {{end}}{{if .EventsImports.Date}}	"github.com/function61/eventkit/guts"
+{{end}}{{range .EventsImports.ModuleIds}}	"{{$.Opts.BackendModulePrefix}}{{$.Module.ImportedModulePath .}}"
 {{end}}	"github.com/function61/eventhorizon/pkg/ehevent"
 )
 
@@ -111,7 +188,8 @@ var EventTypes = ehevent.Allocators{
 
 // constructors
 
-{{range .EventDefs}}
+{{range .EventDefs}}{{with .Deprecated.Message}}
+// Deprecated: {{.}}{{end}}
 func New{{.GoStructName}}({{.CtorArgs}}) *{{.GoStructName}} {
 	return &{{.GoStructName}}{
 		meta: &meta,
@@ -146,13 +224,13 @@ func DispatchEvent(event ehevent.Event, listener EventListener) error {
 
 const BackendTypes = `package {{.Module.Id}}
 
-import ( {{if .StringEnums}}
+import ( {{if .Enums}}
 	"fmt"
 	"encoding/json"{{end}}
 {{if .TypesImports.Date}}	"github.com/function61/eventkit/guts"
 {{end}}{{if .TypesImports.DateTime}}	"time"
 {{end}}{{range .TypesImports.ModuleIds}}
-	"{{$.Opts.BackendModulePrefix}}{{.}}"
+	"{{$.Opts.BackendModulePrefix}}{{$.Module.ImportedModulePath .}}"
 {{end}}
 )
 
@@ -160,10 +238,83 @@ import ( {{if .StringEnums}}
 {{.AsToGoCode}}
 {{end}}
 
-{{range $_, $enum := .StringEnums}}
+{{range $_, $enum := .Enums}}{{if $enum.Integer}}
+type {{$enum.Name}} int
+const (
+{{range $_, $member := $enum.Members}}{{if $member.Description}}
+{{GoComment "\t" $member.Description}}{{end}}{{with $member.Deprecated.Message}}
+	//
+{{GoComment "\t" (print "Deprecated: " .)}}{{end}}
+	{{$member.GoKey}} {{$enum.Name}} = {{$member.GoValue}}{{end}}
+)
+
+var {{$enum.Name}}Members = []{{$enum.Name}}{ {{range $_, $member := $enum.Members}}
+	{{$member.GoKey}},{{end}}
+}
+
+// member's key, like "low"
+func (e {{$enum.Name}}) String() string {
+	switch e { {{range $_, $member := $enum.Members}}
+	case {{$member.GoKey}}:
+		return "{{$member.SpecKey}}"{{end}}
+	default:
+		return fmt.Sprintf("{{$enum.Name}}(%d)", int(e))
+	}
+}
+
+// JSON has the integer (protocol) value
+func (e {{$enum.Name}}) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int(e))
+}
+
+func (e *{{$enum.Name}}) UnmarshalJSON(b []byte) error {
+	var num int
+	if err := json.Unmarshal(b, &num); err != nil {
+		return err
+	}
+	validated, err := {{$enum.Name}}Validate(num)
+	if err != nil {
+		return err
+	}
+	*e = validated
+	return nil
+}
+
+// text form is the member's key
+func (e {{$enum.Name}}) MarshalText() ([]byte, error) {
+	if _, err := {{$enum.Name}}Validate(int(e)); err != nil {
+		return nil, err
+	}
+	return []byte(e.String()), nil
+}
+
+func (e *{{$enum.Name}}) UnmarshalText(text []byte) error {
+	for _, member := range {{$enum.Name}}Members {
+		if member.String() == string(text) {
+			*e = member
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid {{$enum.Name}} member: %s", text)
+}
+
+func {{$enum.Name}}Validate(input int) ({{$enum.Name}}, error) {
+	for _, member := range {{$enum.Name}}Members {
+		if member == {{$enum.Name}}(input) {
+			return member, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid {{$enum.Name}} member: %d", input)
+}
+{{else}}
 type {{$enum.Name}} string
 const (
-{{range $_, $member := $enum.Members}}
+{{range $_, $member := $enum.Members}}{{if $member.Description}}
+{{GoComment "\t" $member.Description}}{{end}}{{with $member.Deprecated.Message}}
+	//
+{{GoComment "\t" (print "Deprecated: " .)}}{{end}}
 	{{$member.GoKey}} {{$enum.Name}} = "{{$member.GoValue}}"{{end}}
 )
 
@@ -171,6 +322,10 @@ var {{$enum.Name}}Members = []{{$enum.Name}}{ {{range $_, $member := $enum.Membe
 	{{$member.GoKey}},{{end}}
 }
 
+func (e {{$enum.Name}}) String() string {
+	return string(e)
+}
+
 func (e *{{$enum.Name}}) MarshalJSON() ([]byte, error) {
 	str := string(*e)
 	return json.Marshal(&str)
@@ -189,6 +344,19 @@ func (e *{{$enum.Name}}) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+func (e {{$enum.Name}}) MarshalText() ([]byte, error) {
+	return []byte(e), nil
+}
+
+func (e *{{$enum.Name}}) UnmarshalText(text []byte) error {
+	validated, err := {{$enum.Name}}Validate(string(text))
+	if err != nil {
+		return err
+	}
+	*e = validated
+	return nil
+}
+
 func {{$enum.Name}}Validate(input string) ({{$enum.Name}}, error) {
 	for _, member := range {{$enum.Name}}Members {
 		if member == {{$enum.Name}}(input) {
@@ -198,7 +366,7 @@ func {{$enum.Name}}Validate(input string) ({{$enum.Name}}, error) {
 
 	return "", fmt.Errorf("invalid {{$enum.Name}} member: %s", input)
 }
-
+{{end}}
 // digest in name because there's no easy way to make exhaustive Enum pattern matching
 // in Go, so we hack around it by calling this generated function everywhere we want
 // to do the pattern match, and when enum members change the digest changes and thus
@@ -216,7 +384,9 @@ const {{.Key}} = "{{.Value}}";
 const BackendRestEndpoints = `package {{.Module.Id}}
 
 import (
+	"context"
 	"encoding/json"
+	"github.com/function61/eventkit/httprestclient"
 	"github.com/function61/gokit/net/http/httpauth"
 	"net/http"
 	"net/url"
@@ -229,7 +399,9 @@ type HttpHandlers interface { {{range .Module.Types.Endpoints}}
 // the following generated code brings type safety from all the way to the
 // backend-frontend path (input/output structs and endpoint URLs) to the REST API
 func RegisterRoutes(handlers HttpHandlers, mwares httpauth.MiddlewareChainMap, register func(method string, path string, fn http.HandlerFunc)) { {{range .Module.Types.Endpoints}}
-	register("{{.HttpMethod}}", "{{StripQueryFromUrl .Path}}", func(w http.ResponseWriter, r *http.Request) {
+	register("{{.HttpMethod}}", "{{StripQueryFromUrl .Path}}", func(w http.ResponseWriter, r *http.Request) { {{if .Deprecated.IsDeprecated}}
+		w.Header().Set("Deprecation", "true")
+{{end}}
 		rctx := mwares["{{.MiddlewareChain}}"](w, r)
 		if rctx == nil {
 			return // middleware aborted request handing and handled error response itself
@@ -279,16 +451,100 @@ func NewRestClientUrlBuilder(baseUrl string) *RestClientUrlBuilder {
 }
 
 {{range .Module.Types.Endpoints}}
-// {{.Path}}
+// {{.Path}}{{with .Deprecated.Message}}
+//
+// Deprecated: {{.}}{{end}}
 func (r *RestClientUrlBuilder) {{UppercaseFirst .Name}}({{.GoArgs}}) string {
 	return r.baseUrl + "{{.GoPath}}"
 }
 {{end}}
 
+// typed client for calling the endpoints from Go. error responses are *httprestclient.Error
+type RestClient struct {
+	client *httprestclient.Client
+}
+
+func NewRestClient(client *httprestclient.Client) *RestClient {
+	return &RestClient{client}
+}
+
+{{range .Module.Types.Endpoints}}
+// {{.HttpMethod}} {{.Path}}{{with .Deprecated.Message}}
+//
+// Deprecated: {{.}}{{end}}
+func (r *RestClient) {{UppercaseFirst .Name}}({{.GoClientArgs}}) {{if .Produces}}(*{{.Produces.AsGoType}}, error){{else}}error{{end}} {
+{{if .Produces}}	output := new({{.Produces.AsGoType}})
+	if err := r.client.Do(ctx, "{{.HttpMethod}}", "{{.GoPath}}", {{if .Consumes}}body{{else}}nil{{end}}, output); err != nil {
+		return nil, err
+	}
+
+	return output, nil{{else}}	return r.client.Do(ctx, "{{.HttpMethod}}", "{{.GoPath}}", {{if .Consumes}}body{{else}}nil{{end}}, nil){{end}}
+}
+{{end}}
+
 // a hack so we don't have to conditionally import net/url module
-// FIXME: path components should be escaped differently than query comps
+func pathEscape(s string) string {
+	return url.PathEscape(s)
+}
+
 func queryEscape(s string) string {
 	return url.QueryEscape(s)
 }
 
 `
+
+const BackendCommandClient = `package {{.Module.Id}}
+
+// WARNING: generated file
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/function61/eventkit/command"
+	"github.com/function61/eventkit/httpcommandclient"
+{{if .CommandsImports.DateTime}}	"time"
+{{end}}{{if .CommandsImports.Date}}	"github.com/function61/eventkit/guts"
+{{end}}{{range .CommandsImports.ModuleIds}}	"{{$.Opts.BackendModulePrefix}}{{$.Module.ImportedModulePath .}}"
+{{end}})
+
+// typed wrapper for invoking this module's commands over HTTP. when spec changes, the
+// method signatures change so callers' compile breaks instead of the requests failing.
+// ctor args are positional parameters, other fields are optional via XxxOpts structs.
+type CommandClient struct {
+	client *httpcommandclient.Client
+}
+
+func NewCommandClient(client *httpcommandclient.Client) *CommandClient {
+	return &CommandClient{client}
+}
+{{range .Module.Commands}}{{if .ClientOptFields}}
+// optional fields of {{.Command}}. nil fields are left out of the request, so the server
+// applies their defaults
+type {{.AsGoStructName}}Opts struct { {{range .ClientOptFields}}{{with .Deprecated.Message}}
+	// Deprecated: {{.}}{{end}}
+	{{.Key}} {{.GoClientOptType $.Module}}{{end}}
+}
+{{end}}
+// {{.Command}}{{if .ReturnsCreatedRecordId}} (returns ID of the created record){{end}}{{with .Deprecated.Message}}
+//
+// Deprecated: {{.}}{{end}}
+func (c *CommandClient) {{.AsGoStructName}}(ctx context.Context{{with .GoClientArgs $.Module}}, {{.}}{{end}}) {{if .ReturnsCreatedRecordId}}(string, error){{else}}error{{end}} {
+	cmd := &{{.AsGoStructName}}{ {{- .GoDefaults $.Module -}} }
+	payload := map[string]interface{}{}
+{{with .GoClientAssignments $.Module}}
+	{{.}}
+{{end}}
+	return c.client.{{if .ReturnsCreatedRecordId}}ExecExpectingCreatedRecordId{{else}}Exec{{end}}(ctx, &partialCommand{cmd, payload})
+}
+{{end}}
+// sends only the given fields, so the server applies its defaults to the rest. the full
+// command (with defaults filled in) is used for validating before sending
+type partialCommand struct {
+	command.Command
+	payload map[string]interface{}
+}
+
+func (p *partialCommand) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.payload)
+}
+`
@@ -9,7 +9,9 @@ const DocsEvents = `Each and every *Event* additionally has the following common
 {{range .Module.Events.Events}}
 {{.Event}}
 -------
-
+{{with .Deprecated.Message}}
+**Deprecated**: {{.}}
+{{end}}
 {{if .Changelog}}
 Changelog:
 {{range .Changelog}}
@@ -33,12 +35,14 @@ Constants
 {{end}}
 {{end}}
 
-{{range .Module.Types.Enums}}
+{{range .Enums}}
 enum {{.Name}}
 ---------
 
-{{range .StringMembers}}
-- {{.}}{{end}}
+| value | label | description |
+|-------|-------|-------------|
+{{range .Members}}| {{.GoValue}}{{if .Deprecated.IsDeprecated}} (deprecated){{end}} | {{.Label}} | {{with .Deprecated.Message}}**Deprecated**: {{.}} {{end}}{{.Description}} |
+{{end}}
 {{end}}
 
 {{range .Module.Types.Types}}
@@ -56,15 +60,17 @@ const DocsCommands = `Overview
 
 | Endpoint | Middleware | Title |
 |----------|------------|-------| {{range .Module.Commands}}
-| POST /command/{{.Command}} | {{.MiddlewareChain}} | {{.Title}} | {{end}}
+| POST /command/{{.Command}} | {{.MiddlewareChain}} | {{.Title}}{{if .Deprecated.IsDeprecated}} (deprecated){{end}} | {{end}}
 
 {{range .Module.Commands}}
 {{.Command}}
 ------------
-
-| Field | Type | Required | Notes |
-|-------|------|----------|-------|
-{{range .Fields}}| {{.Key}} | {{.Type}} | {{not .Optional}} | {{.Help}} |
+{{with .Deprecated.Message}}
+**Deprecated**: {{.}}
+{{end}}
+| Field | Type | Required | Default | Notes |
+|-------|------|----------|---------|-------|
+{{range .Fields}}| {{.Key}} | {{.Type}}{{if .ListOf}} of {{.ListOf}}{{end}} | {{not .Optional}} | {{.DefaultJson}} | {{with .Deprecated.Message}}**Deprecated**: {{.}} {{end}}{{.Help}} |
 {{end}}
 {{end}}
 `
@@ -74,7 +80,7 @@ const DocsRestEndpoints = `Overview
 
 | Path | Middleware | Input | Output | Notes |
 |------|------------|-------|--------|-------|
-{{range .Module.Types.Endpoints}}| {{.HttpMethod}} {{.Path}} | {{.MiddlewareChain}} | {{if .Consumes}}{{.Consumes.AsTypeScriptType}}{{end}} | {{if .Produces}}{{.Produces.AsTypeScriptType}}{{end}} | {{.Description}} |
+{{range .Module.Types.Endpoints}}| {{.HttpMethod}} {{.Path}} | {{.MiddlewareChain}} | {{if .Consumes}}{{.Consumes.AsTypeScriptType}}{{end}} | {{if .Produces}}{{.Produces.AsTypeScriptType}}{{end}} | {{with .Deprecated.Message}}**Deprecated**: {{.}} {{end}}{{.Description}} |
 {{end}}
 
 {{range .Module.Types.Endpoints}}
@@ -86,7 +92,8 @@ const DocsRestEndpoints = `Overview
 | Middleware chain | {{.MiddlewareChain}}                                  |
 | Consumes         | {{if .Consumes}}{{.Consumes.AsTypeScriptType}}{{end}} |
 | Produces         | {{if .Produces}}{{.Produces.AsTypeScriptType}}{{end}} |
-| Description      | {{.Description}}                                      |
+| Description      | {{.Description}}                                      |{{with .Deprecated.Message}}
+| Deprecated       | {{.}} |{{end}}
 
 {{end}}
 `
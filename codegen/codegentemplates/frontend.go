@@ -4,7 +4,7 @@ const FrontendDatatypes = `// tslint:disable
 // WARNING: generated file
 
 {{range .TypesImports.ModuleIds}}
-import * as {{.}} from '{{$.Opts.FrontendModulePrefix}}{{.}}_types';{{end}}
+import * as {{.}} from '{{$.Opts.FrontendModulePrefix}}{{$.Module.ImportedModulePath .}}_types';{{end}}
 {{if .TypesImports.Date}}import {dateRFC3339} from 'f61ui/types';
 {{end}}
 {{if .TypesImports.DateTime}}import {datetimeRFC3339} from 'f61ui/types';
@@ -12,11 +12,17 @@ import * as {{.}} from '{{$.Opts.FrontendModulePrefix}}{{.}}_types';{{end}}
 {{if .TypesImports.Binary}}import {binaryBase64} from 'f61ui/types';
 {{end}}
 
-{{range .StringEnums}}
-export enum {{.Name}} {
-{{range .Members}}
-	{{.Key}} = '{{.GoValue}}',{{end}}
+{{range $enum := .Enums}}
+export enum {{$enum.Name}} {
+{{range $enum.Members}}{{with .Deprecated.TsDoc}}
+	{{.}}{{end}}
+	{{.Key}} = {{if $enum.Integer}}{{.GoValue}}{{else}}'{{.GoValue}}'{{end}},{{end}}
 }
+
+export const {{$enum.Name}}Labels: Record<{{$enum.Name}}, string> = {
+{{range $enum.Members}}
+	[{{$enum.Name}}.{{.Key}}]: '{{EscapeForJsSingleQuote .Label}}',{{end}}
+};
 {{end}}
 {{range .Module.Types.StringConsts}}
 export const {{.Key}} = '{{EscapeForJsSingleQuote .Value}}';{{end}}
@@ -40,11 +46,13 @@ import {
 } from 'f61ui/httputil';
 
 {{range .Module.Types.Endpoints}}
-// {{.Path}}
+// {{.Path}}{{with .Deprecated.TsDoc}}
+{{.}}{{end}}
 export function {{.Name}}({{.TypescriptArgs}}) {
 	return {{if .Consumes}}postJson<{{if .Consumes}}{{.Consumes.AsTypeScriptType}}{{else}}void{{end}}, {{if .Produces}}{{.Produces.AsTypeScriptType}}{{else}}void{{end}}>{{else}}getJson<{{if .Produces}}{{.Produces.AsTypeScriptType}}{{else}}void{{end}}>{{end}}(` + "`{{.TypescriptPath}}`" + `{{if .Consumes}}, body{{end}});
 }
-{{if not .Consumes}}
+{{if not .Consumes}}{{with .Deprecated.TsDoc}}
+{{.}}{{end}}
 export function {{.Name}}Url({{.TypescriptArgs}}): string {
 	return ` + "`{{.TypescriptPath}}`" + `;
 }{{end}}
@@ -56,7 +64,8 @@ const FrontendCommandDefinitions = `// tslint:disable
 
 {{if .Module.Commands.ImportedCustomFieldTypes}}import { {{range .Module.Commands.ImportedCustomFieldTypes}}
 	{{.}},{{end}}
-} from '{{$.Opts.FrontendModulePrefix}}{{.Module.Path}}_types';{{end}}
+} from '{{$.Opts.FrontendModulePrefix}}{{.Module.Path}}_types';{{end}}{{range .CommandsImportsUi.ModuleIds}}
+import * as {{.}} from '{{$.Opts.FrontendModulePrefix}}{{$.Module.ImportedModulePath .}}_types';{{end}}
 // prefixing with c is cumbersome but less than having to conditionally import the exports
 // because some of them are required on rarer cases in generated code
 import * as c from 'f61ui/commandtypes';
@@ -65,7 +74,8 @@ import * as c from 'f61ui/commandtypes';
 {{if .CommandsImportsUi.DateTime}}import {datetimeRFC3339} from 'f61ui/types';
 {{end}}
 
-{{range .Module.Commands}}
+{{range .Module.Commands}}{{with .Deprecated.TsDoc}}
+{{.}}{{end}}
 export function {{.AsGoStructName}}({{if .CtorArgsForTypeScript}}{{.CtorArgsForTypeScript}}, {{end}}{{if .CustomFields}}customFields: { {{range .CustomFields}}{{.Key}}: c.CustomFieldInputFactory<{{.AsTsType}}>,{{end}} }, {{end}}settings: c.CommandSettings = {}): c.CommandDefinition {
 	return {
 		key: '{{.Command}}',{{if .AdditionalConfirmation}}
@@ -80,7 +90,139 @@ export function {{.AsGoStructName}}({{if .CtorArgsForTypeScript}}{{.CtorArgsForT
 		customFields,{{end}}
 	};
 }
+
+// validates payload like the server does. returns null if valid{{with .Deprecated.TsDoc}}
+{{.}}{{end}}
+export function {{.AsGoStructName}}Validate({{if .MakeTsValidation $.Module}}x{{else}}_x{{end}}: any): CommandValidationError | null {
+{{with .MakeTsValidation $.Module}}	{{.}}
+{{end}}	return null;
+}
 {{end}}
+// util functions. codes and messages must match those of the generated Go validation
+
+export interface CommandValidationError {
+	field: string;
+	code: string;
+	message: string;
+}
+
+export function regexpValidation(fieldName: string, pattern: string, content: string): CommandValidationError | null {
+	if (!new RegExp(pattern).test(content)) {
+		return fieldValidationError(fieldName, 'field_pattern_mismatch', 'field ' + fieldName + ' does not match pattern ' + pattern);
+	}
+
+	return null;
+}
+
+// format is "email" | "url" | ... empty content is not validated (presence is validated separately)
+export function formatValidation(fieldName: string, format: string, pattern: string, content: string): CommandValidationError | null {
+	if (content !== '' && !new RegExp(pattern).test(content)) {
+		return fieldValidationError(fieldName, 'field_invalid_format', 'field ' + fieldName + ' is not a valid ' + format);
+	}
+
+	return null;
+}
+
+export function noNewlinesValidation(fieldName: string, content: string): CommandValidationError | null {
+	if (/[\r\n]/.test(content)) {
+		return fieldValidationError(fieldName, 'field_contains_newlines', 'single-line field ' + fieldName + ' contains newlines');
+	}
+
+	return null;
+}
+
+export function fieldEmptyValidationError(fieldName: string): CommandValidationError {
+	return fieldValidationError(fieldName, 'field_empty', 'field ' + fieldName + ' cannot be empty');
+}
+
+export function fieldLengthValidationError(fieldName: string, maxLength: number, got: number): CommandValidationError {
+	return fieldValidationError(fieldName, 'field_too_long', 'field ' + fieldName + ' exceeded maximum length ' + maxLength + ' (got ' + got + ')');
+}
+
+export function fieldMinLengthValidationError(fieldName: string, minLength: number, got: number): CommandValidationError {
+	return fieldValidationError(fieldName, 'field_too_short', 'field ' + fieldName + ' is shorter than minimum length ' + minLength + ' (got ' + got + ')');
+}
+
+// constraint is like "at least 10"
+export function fieldRangeValidationError(fieldName: string, constraint: string, got: number | string): CommandValidationError {
+	return fieldValidationError(fieldName, 'field_out_of_range', 'field ' + fieldName + ' must be ' + constraint + ' (got ' + got + ')');
+}
+
+// constraint is like "at least 10"
+export function fieldItemCountValidationError(fieldName: string, constraint: string, got: number): CommandValidationError {
+	return fieldValidationError(fieldName, 'field_item_count', 'field ' + fieldName + ' must have ' + constraint + ' items (got ' + got + ')');
+}
+
+export function fieldValidationError(fieldName: string, code: string, message: string): CommandValidationError {
+	return { field: fieldName, code, message };
+}
+
+// min, max and step are '' if not set. compared as integers scaled to the same number of
+// decimals, so steps like 0.01 work (exact up to ~15 significant digits)
+export function decimalRangeValidation(fieldName: string, content: string, min: string, max: string, step: string): CommandValidationError | null {
+	if (content === '') { // presence is validated separately
+		return null;
+	}
+
+	if (!/^-?[0-9]+(\.[0-9]+)?$/.test(content)) {
+		return fieldValidationError(fieldName, 'field_invalid_format', 'field ' + fieldName + ' is not a valid decimal');
+	}
+
+	const decimals = [content, min || '0', max || '0', step || '1'];
+	const scale = Math.max.apply(null, decimals.map((decimal) => (decimal.split('.')[1] || '').length));
+	const [value, base, maxScaled, stepScaled] = decimals.map((decimal) => {
+		let fraction = decimal.split('.')[1] || '';
+		while (fraction.length < scale) {
+			fraction += '0';
+		}
+
+		return parseInt(decimal.split('.')[0] + fraction, 10);
+	});
+
+	if (min !== '' && value < base) {
+		return fieldRangeValidationError(fieldName, 'at least ' + min, content);
+	}
+
+	if (max !== '' && value > maxScaled) {
+		return fieldRangeValidationError(fieldName, 'at most ' + max, content);
+	}
+
+	if (step !== '' && (value - base) % stepScaled !== 0) {
+		let constraint = 'a multiple of ' + step;
+		if (min !== '' && base !== 0) {
+			constraint = min + ' plus ' + constraint;
+		}
+
+		return fieldRangeValidationError(fieldName, constraint, content);
+	}
+
+	return null;
+}
+
+// length in UTF-8 bytes, because that's what Go's len() measures
+export function byteLength(str: string): number {
+	let length = 0;
+	for (let idx = 0; idx < str.length; idx++) {
+		const code = str.charCodeAt(idx);
+		if (code < 0x80) {
+			length += 1;
+		} else if (code < 0x800) {
+			length += 2;
+		} else if (code >= 0xd800 && code <= 0xdbff) { // surrogate pair
+			length += 4;
+			idx++;
+		} else {
+			length += 3;
+		}
+	}
+
+	return length;
+}
+
+// what Go sees for fields absent from JSON (or null) is the default or the zero value
+export function valueOr<T>(value: T | null | undefined, absentValue: T): T {
+	return value === undefined || value === null ? absentValue : value;
+}
 `
 
 const FrontendVersion = `// tslint:disable
@@ -90,3 +232,134 @@ export const version = '{{.Version}}';
 
 export const isDevVersion = {{if eq .Version "dev"}}true{{else}}false{{end}};
 `
+
+const FrontendEvents = `// tslint:disable
+// WARNING: generated file
+
+{{if .Module.Events.TsImportedCustomTypes}}import { {{range .Module.Events.TsImportedCustomTypes}}
+	{{.}},{{end}}
+} from '{{$.Opts.FrontendModulePrefix}}{{.Module.Path}}_types';{{end}}
+{{range .EventsImports.ModuleIds}}
+import * as {{.}} from '{{$.Opts.FrontendModulePrefix}}{{$.Module.ImportedModulePath .}}_types';{{end}}
+{{if .EventsImports.Date}}import {dateRFC3339} from 'f61ui/types';
+{{end}}
+import {datetimeRFC3339} from 'f61ui/types';
+{{if .EventsImports.Binary}}import {binaryBase64} from 'f61ui/types';
+{{end}}
+
+// common to all events
+export interface EventMeta {
+	stream: string;
+	timestamp: datetimeRFC3339;
+	user_id: string;
+	impersonating_user_id?: string;
+}
+{{range .Module.Events.Events}}
+// {{.Event}}{{with .Deprecated.TsDoc}}
+{{.}}{{end}}
+export interface {{.GoStructName}} {
+	{{.TsFields}}
+}
+{{with .Deprecated.TsDoc}}
+{{.}}{{end}}
+export interface {{.GoStructName}}Event extends EventMeta {
+	type: '{{.Event}}';
+	payload: {{.GoStructName}};
+}
+{{end}}
+// discriminated by "type"
+export type DomainEvent = {{range $idx, $event := .Module.Events.Events}}{{if $idx}}
+	| {{end}}{{$event.GoStructName}}Event{{else}}never{{end}};
+
+// validates that input looks like an event of this module, and returns it typed. throws if not.
+// types from other modules are not validated.
+export function decodeEvent(input: any): DomainEvent {
+	checkShape(input, metaSchema, 'event');
+
+	const payloadSchema = payloadSchemas[input.type];
+	if (payloadSchema === undefined) {
+		throw new Error(` + "`event: unknown type ${input.type}`" + `);
+	}
+
+	checkShape(input.payload, payloadSchema, 'event.payload');
+
+	return input as DomainEvent;
+}
+
+interface Schema {
+	kind: 'string' | 'integer' | 'boolean' | 'any' | 'nullable' | 'list' | 'object' | 'oneOf' | 'ref';
+	of?: Schema; // nullable | list
+	fields?: { [key: string]: Schema }; // object
+	values?: Array<string | number>; // oneOf
+	ref?: string; // ref
+}
+
+const metaSchema: Schema = { kind: 'object', fields: {
+	type: { kind: 'string' },
+	stream: { kind: 'string' },
+	timestamp: { kind: 'string' },
+	user_id: { kind: 'string' },
+	impersonating_user_id: { kind: 'nullable', of: { kind: 'string' } },
+} };
+
+const payloadSchemas: { [eventType: string]: Schema } = { {{range .Module.Events.Events}}
+	'{{.Event}}': {{.TsPayloadSchema $.Module}},{{end}}
+};
+
+const namedTypeSchemas: { [name: string]: Schema } = {
+{{.Module.Events.TsNamedTypeSchemas $.Module}}
+};
+
+function checkShape(value: any, schema: Schema, path: string): void {
+	const mismatch = (expected: string) => new Error(` + "`${path}: expected ${expected}, got ${JSON.stringify(value)}`" + `);
+
+	switch (schema.kind) {
+		case 'any':
+			return;
+		case 'string':
+			if (typeof value !== 'string') {
+				throw mismatch('string');
+			}
+			return;
+		case 'integer':
+			if (typeof value !== 'number' || Math.floor(value) !== value) {
+				throw mismatch('integer');
+			}
+			return;
+		case 'boolean':
+			if (typeof value !== 'boolean') {
+				throw mismatch('boolean');
+			}
+			return;
+		case 'nullable':
+			if (value !== null && value !== undefined) {
+				checkShape(value, schema.of!, path);
+			}
+			return;
+		case 'list':
+			if (!Array.isArray(value)) {
+				throw mismatch('list');
+			}
+			value.forEach((item: any, idx: number) => {
+				checkShape(item, schema.of!, ` + "`${path}[${idx}]`" + `);
+			});
+			return;
+		case 'object':
+			if (typeof value !== 'object' || value === null || Array.isArray(value)) {
+				throw mismatch('object');
+			}
+			Object.keys(schema.fields!).forEach((key) => {
+				checkShape(value[key], schema.fields![key], ` + "`${path}.${key}`" + `);
+			});
+			return;
+		case 'oneOf':
+			if (schema.values!.indexOf(value) === -1) {
+				throw mismatch(` + "`one of ${schema.values!.join(', ')}`" + `);
+			}
+			return;
+		case 'ref':
+			checkShape(value, namedTypeSchemas[schema.ref!], path);
+			return;
+	}
+}
+`
@@ -2,13 +2,157 @@ package codegentemplates
 
 const BackendUiRoutes = `package {{.Module.Id}}
 
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// router-agnostic. paths have placeholders like "/persons/{id}", which both gorilla/mux and
+// net/http's ServeMux (Go 1.22+) understand. with ServeMux:
+//
+//	RegisterUiRoutesWith(uiHandler, serveMux.HandleFunc)
+func RegisterUiRoutesWith(uiHandler http.HandlerFunc, register func(path string, handler func(http.ResponseWriter, *http.Request))) { {{range .Module.UiRoutes}}
+	register("{{.Path}}", uiHandler){{end}}
+}
+{{range .Module.UiRoutes}}
+{{if .HasOpts}}type {{.GoOptsName}} struct { {{range .GoPathParams}}
+	{{.GoField}} {{.GoType}}{{end}}{{range .GoQueryParams}}
+	{{.GoField}} {{.GoType}}{{end}}
+}
+{{end}}
+// {{.Path}}
+func {{.GoName}}URL({{if .HasOpts}}opts {{.GoOptsName}}{{end}}) string {
+	query := url.Values{}
+{{range .GoQueryParams}}{{if .Nullable}}	if opts.{{.GoField}} != nil {
+		query.Set("{{.Key}}", {{if .Integer}}strconv.Itoa(*opts.{{.GoField}}){{else}}*opts.{{.GoField}}{{end}})
+	}
+{{else}}	query.Set("{{.Key}}", {{if .Integer}}strconv.Itoa(opts.{{.GoField}}){{else}}opts.{{.GoField}}{{end}})
+{{end}}{{end}}
+	return uiRouteUrl({{.GoPath}}, query)
+}
+
+var {{.Id}}UiRouteRe = regexp.MustCompile({{.PathReGo}})
+
+{{if .HasOpts}}// nil if path is not for this route. error if it is, but params are invalid
+func {{.GoName}}Match(path string, query url.Values) (*{{.GoOptsName}}, error) {
+	matches := {{.Id}}UiRouteRe.FindStringSubmatch(path)
+	if matches == nil {
+		return nil, nil
+	}
+
+	if err := uiRouteAssertNoUnrecognizedKeys(query{{range .QueryParams}}, "{{.Key}}"{{end}}); err != nil {
+		return nil, err
+	}
+{{range $idx, $param := .GoPathParams}}
+	{{$param.Key}}Par, err := url.PathUnescape(matches[{{add $idx 1}}])
+	if err != nil {
+		return nil, err
+	}
+{{end}}{{range .GoQueryParams}}
+	{{.Key}}Par, err := uiRouteQuery{{if .Integer}}Int{{else}}String{{end}}(query, "{{.Key}}", {{not .Nullable}})
+	if err != nil {
+		return nil, err
+	}
+{{end}}
+	return &{{.GoOptsName}}{ {{range .GoPathParams}}
+		{{.GoField}}: {{.Key}}Par,{{end}}{{range .GoQueryParams}}
+		{{.GoField}}: {{if not .Nullable}}*{{end}}{{.Key}}Par,{{end}}
+	}, nil
+}
+{{else}}// false if path is not for this route. error if it is, but params are invalid
+func {{.GoName}}Match(path string, query url.Values) (bool, error) {
+	if !{{.Id}}UiRouteRe.MatchString(path) {
+		return false, nil
+	}
+
+	if err := uiRouteAssertNoUnrecognizedKeys(query); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+{{end}}{{end}}
+func uiRouteUrl(path string, query url.Values) string {
+	if len(query) == 0 {
+		return path
+	}
+
+	return path + "?" + query.Encode()
+}
+
+// nil if absent (error if required)
+func uiRouteQueryString(query url.Values, key string, required bool) (*string, error) {
+	values := query[key]
+	if len(values) == 0 {
+		if required {
+			return nil, fmt.Errorf("required URL param '%s' missing", key)
+		}
+
+		return nil, nil
+	}
+
+	return &values[0], nil
+}
+
+// nil if absent (error if required)
+func uiRouteQueryInt(query url.Values, key string, required bool) (*int, error) {
+	str, err := uiRouteQueryString(query, key, required)
+	if err != nil || str == nil {
+		return nil, err
+	}
+
+	num, err := strconv.Atoi(*str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL param '%s': expecting integer, got '%s'", key, *str)
+	}
+
+	return &num, nil
+}
+
+func uiRouteAssertNoUnrecognizedKeys(query url.Values, allowedKeys ...string) error {
+	unrecognizedKeys := []string{}
+
+	for key := range query {
+		allowed := false
+		for _, allowedKey := range allowedKeys {
+			if key == allowedKey {
+				allowed = true
+			}
+		}
+
+		if !allowed {
+			unrecognizedKeys = append(unrecognizedKeys, key)
+		}
+	}
+
+	if len(unrecognizedKeys) > 0 {
+		sort.Strings(unrecognizedKeys)
+
+		return fmt.Errorf("unrecognized keys in URL params: %s", strings.Join(unrecognizedKeys, ", "))
+	}
+
+	return nil
+}
+`
+
+// separate file so projects not using gorilla/mux don't have to depend on it
+const BackendUiRoutesGorillaMux = `package {{.Module.Id}}
+
 import (
 	"github.com/gorilla/mux"
 	"net/http"
 )
 
-func RegisterUiRoutes(routes *mux.Router, uiHandler http.HandlerFunc) { {{range .Module.UiRoutes}}
-	routes.HandleFunc("{{.Path}}", uiHandler){{end}}
+// registers all UI routes to gorilla/mux. for other routers use RegisterUiRoutesWith()
+func RegisterUiRoutes(routes *mux.Router, uiHandler http.HandlerFunc) {
+	RegisterUiRoutesWith(uiHandler, func(path string, handler func(http.ResponseWriter, *http.Request)) {
+		routes.HandleFunc(path, handler)
+	})
 }
 `
 
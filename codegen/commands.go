@@ -1,9 +1,14 @@
 package codegen
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"go/token"
+	"math"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/function61/gokit/sliceutil"
 )
@@ -25,8 +30,10 @@ func (c *CommandSpecFile) ImportedCustomFieldTypes() []string {
 
 	for _, cmd := range *c {
 		for _, field := range cmd.Fields {
-			// only types mentioned in ctor need importing
-			if isCustomType(field.Type) && sliceutil.ContainsString(cmd.CtorArgs, field.Key) {
+			// only types mentioned in ctor need importing. other modules' types are imported
+			// as a whole module
+			isOwnType := isCustomType(field.Type) && (&DatatypeDef{NameRaw: field.Type}).ModuleId() == ""
+			if isOwnType && sliceutil.ContainsString(cmd.CtorArgs, field.Key) {
 				// only append once
 				if !sliceutil.ContainsString(customTypes, field.Type) {
 					customTypes = append(customTypes, field.Type)
@@ -47,6 +54,7 @@ type CommandSpec struct {
 	CtorArgs               []string            `json:"ctor"`
 	Fields                 []*CommandFieldSpec `json:"fields"`
 	Info                   []string            `json:"info"`
+	Deprecated             Deprecation         `json:"deprecated"`
 }
 
 func (c *CommandSpec) AsGoStructName() string {
@@ -70,89 +78,129 @@ func (c *CommandSpec) Validate(module *Module) error {
 }
 
 type CommandFieldSpec struct {
-	Key                string `json:"key"`
-	Title              string `json:"title"`
-	Type               string `json:"type"`
-	Unit               string `json:"unit"`
-	ValidationRegex    string `json:"validation_regex"`
-	MaxLength          *int   `json:"max_length"`
-	Optional           bool   `json:"optional"`
-	HideIfDefaultValue bool   `json:"hideIfDefaultValue"`
-	Help               string `json:"help"`
-	Placeholder        string `json:"placeholder"`
+	Key                string      `json:"key"`
+	Title              string      `json:"title"`
+	Type               string      `json:"type"`
+	ListOf             string      `json:"of"` // item type if Type is "list"
+	Unit               string      `json:"unit"`
+	ValidationRegex    string      `json:"validation_regex"`
+	MaxLength          *int        `json:"max_length"`
+	MinLength          *int        `json:"min_length"`
+	Min                *float64    `json:"min"`       // integer | decimal (or list of them)
+	Max                *float64    `json:"max"`       // integer | decimal (or list of them)
+	Step               *float64    `json:"step"`      // valid values are min + n*step (min defaults to 0)
+	MinItems           *int        `json:"min_items"` // list
+	MaxItems           *int        `json:"max_items"` // list
+	Default            interface{} `json:"default"`   // seeds UI form, and applied server-side if field absent from JSON
+	Optional           bool        `json:"optional"`
+	HideIfDefaultValue bool        `json:"hideIfDefaultValue"`
+	Help               string      `json:"help"`
+	Placeholder        string      `json:"placeholder"`
+	Deprecated         Deprecation `json:"deprecated"`
+}
+
+// types of fields whose syntax is validated. patterns are used by the generated code as-is,
+// so keep to regex syntax that is common to all target languages
+var fieldFormatPatterns = map[string]string{
+	"decimal": `^-?[0-9]+(\.[0-9]+)?$`,
+	"email":   `^[^@\s]+@[^@\s]+\.[^@\s]+$`,
+	"url":     `^https?://[^/?#\s]+[^\s]*$`,
+	"uuid":    `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`,
+}
+
+// types that list fields can have as their items
+var listItemTypes = []string{"text", "integer", "decimal", "email", "url", "uuid"}
+
+// list item type => CommandFieldKind in UI
+var listItemTsKinds = map[string]string{
+	"text":    "Text",
+	"integer": "Integer",
+	"decimal": "Decimal",
+	"email":   "Email",
+	"url":     "Url",
+	"uuid":    "Uuid",
 }
 
 func (c *CommandFieldSpec) AsValidationSnippet(module *Module) string {
 	goType := c.AsGoType(module)
 
-	if goType == "string" || goType == "password" {
-		maxLen := 128
+	if c.Type == "list" {
+		snippets := []string{}
 
-		if c.MaxLength != nil {
-			maxLen = *c.MaxLength
-		} else if c.Type == "multiline" {
-			maxLen = 4 * 1024
-		}
-
-		emptySnippet := ""
-
-		if !c.Optional {
-			emptySnippet = fmt.Sprintf(
-				`if x.%s == "" {
+		if !c.Optional && !c.minItemsRequiresNonEmpty() {
+			snippets = append(snippets, fmt.Sprintf(
+				`if len(x.%s) == 0 {
 		return fieldEmptyValidationError("%s")
-	}
-	`,
+	}`,
 				c.Key,
-				c.Key)
+				c.Key))
 		}
 
-		lengthSnippet := fmt.Sprintf(
-			`if len(x.%s) > %d {
-		return fieldLengthValidationError("%s", %d, len(x.%s))
-	}
-	`,
-			c.Key,
-			maxLen,
-			c.Key,
-			maxLen,
-			c.Key)
-
-		regexSnippet := ""
-		if c.ValidationRegex != "" {
-			regexSnippet = fmt.Sprintf(
-				`if err := regexpValidation("%s", "%s", x.%s); err != nil {
-		return err
-	}
-	`,
+		if c.MinItems != nil {
+			snippets = append(snippets, fmt.Sprintf(
+				`if len(x.%s) < %d {
+		return fieldItemCountValidationError("%s", "at least %d", len(x.%s))
+	}`,
 				c.Key,
-				strings.Replace(c.ValidationRegex, `\`, `\\`, -1),
-				c.Key)
+				*c.MinItems,
+				c.Key,
+				*c.MinItems,
+				c.Key))
 		}
 
-		noNewlinesSnippet := ""
-		if c.Type != "multiline" {
-			noNewlinesSnippet = fmt.Sprintf(
-				`if err := noNewlinesValidation("%s", x.%s); err != nil {
-		return err
+		if c.MaxItems != nil {
+			snippets = append(snippets, fmt.Sprintf(
+				`if len(x.%s) > %d {
+		return fieldItemCountValidationError("%s", "at most %d", len(x.%s))
 	}`,
 				c.Key,
+				*c.MaxItems,
 				c.Key,
-			)
+				*c.MaxItems,
+				c.Key))
+		}
+
+		// items can't be empty, even if the list can
+		if itemSnippet := c.listItemSpec().valueValidationSnippet(module, "item", "\t\t"); itemSnippet != "" {
+			snippets = append(snippets, fmt.Sprintf(
+				`for _, item := range x.%s {
+		%s
+	}`,
+				c.Key,
+				itemSnippet))
+		}
+
+		return strings.Join(snippets, "\n\t")
+	} else if goType == "time.Time" {
+		if c.Optional {
+			return ""
 		}
 
-		return emptySnippet + lengthSnippet + regexSnippet + noNewlinesSnippet
-	} else if goType == "bool" || goType == "int" || goType == "guts.Date" {
+		return fmt.Sprintf(
+			`if x.%s.IsZero() {
+		return fieldEmptyValidationError("%s")
+	}`,
+			c.Key,
+			c.Key)
+	} else if goType == "bool" || goType == "guts.Date" {
 		// presence check not possible for these types
 		return ""
+	} else if goType == "string" || goType == "int" {
+		return c.valueValidationSnippet(module, "x."+c.Key, "\t")
 	} else if isCustomType(goType) {
 		emptySnippet := ""
 
 		if !c.Optional {
-			compareTo := "nil"
-			if module.HasEnum(goType) { // string enum
-				compareTo = `""`
+			compareTo := "nil" // struct
+			if enum := module.enumByName(goType); enum != nil {
+				if !enum.IsInteger() {
+					compareTo = `""`
+				} else if !enum.hasMemberWithValue(0) {
+					compareTo = "0"
+				} else { // zero value is a valid member, so can't tell absence from it
+					return ""
+				}
 			}
-			// else: struct (nil)
 
 			emptySnippet = fmt.Sprintf(
 				`if x.%s == %s {
@@ -170,6 +218,256 @@ func (c *CommandFieldSpec) AsValidationSnippet(module *Module) string {
 	}
 }
 
+// validations for a string or an integer whose value is in expr
+func (c *CommandFieldSpec) valueValidationSnippet(module *Module, expr string, indent string) string {
+	snippets := []string{}
+
+	// formats "if <cond> {\n\treturn <returnExpr>\n}" with our indentation
+	ifReturn := func(cond string, returnExpr string) string {
+		return fmt.Sprintf("if %s {\n%s\treturn %s\n%s}", cond, indent, returnExpr, indent)
+	}
+
+	switch c.AsGoType(module) {
+	case "int": // presence check not possible
+		if c.Min != nil {
+			snippets = append(snippets, ifReturn(
+				fmt.Sprintf("%s < %s", expr, formatNumber(*c.Min)),
+				fmt.Sprintf(`fieldRangeValidationError("%s", "at least %s", %s)`, c.Key, formatNumber(*c.Min), expr)))
+		}
+
+		if c.Max != nil {
+			snippets = append(snippets, ifReturn(
+				fmt.Sprintf("%s > %s", expr, formatNumber(*c.Max)),
+				fmt.Sprintf(`fieldRangeValidationError("%s", "at most %s", %s)`, c.Key, formatNumber(*c.Max), expr)))
+		}
+
+		if c.hasStepConstraint() {
+			snippets = append(snippets, ifReturn(
+				fmt.Sprintf("(%s-%s)%%%s != 0", expr, formatNumber(c.stepBase()), formatNumber(*c.Step)),
+				fmt.Sprintf(`fieldRangeValidationError("%s", "%s", %s)`, c.Key, c.stepConstraint(), expr)))
+		}
+	case "string":
+		if !c.Optional {
+			snippets = append(snippets, ifReturn(
+				expr+` == ""`,
+				fmt.Sprintf(`fieldEmptyValidationError("%s")`, c.Key)))
+		}
+
+		if c.MinLength != nil {
+			cond := fmt.Sprintf("len(%s) < %d", expr, *c.MinLength)
+			if c.Optional { // empty is fine
+				cond = fmt.Sprintf(`%s != "" && %s`, expr, cond)
+			}
+
+			snippets = append(snippets, ifReturn(
+				cond,
+				fmt.Sprintf(`fieldMinLengthValidationError("%s", %d, len(%s))`, c.Key, *c.MinLength, expr)))
+		}
+
+		maxLen := c.maxLength()
+
+		snippets = append(snippets, ifReturn(
+			fmt.Sprintf("len(%s) > %d", expr, maxLen),
+			fmt.Sprintf(`fieldLengthValidationError("%s", %d, len(%s))`, c.Key, maxLen, expr)))
+
+		if c.ValidationRegex != "" {
+			snippets = append(snippets, ifReturn(
+				fmt.Sprintf(`err := regexpValidation("%s", "%s", %s); err != nil`, c.Key, strings.Replace(c.ValidationRegex, `\`, `\\`, -1), expr),
+				"err"))
+		}
+
+		if pattern, hasFormat := fieldFormatPatterns[c.Type]; hasFormat {
+			snippets = append(snippets, ifReturn(
+				fmt.Sprintf(`err := formatValidation("%s", "%s", %s, %s); err != nil`, c.Key, c.Type, strconv.Quote(pattern), expr),
+				"err"))
+		}
+
+		if c.Type == "decimal" && (c.Min != nil || c.Max != nil || c.Step != nil) {
+			optionalNumber := func(num *float64) string {
+				if num == nil {
+					return `""`
+				}
+
+				return `"` + formatNumber(*num) + `"`
+			}
+
+			snippets = append(snippets, ifReturn(
+				fmt.Sprintf(
+					`err := decimalRangeValidation("%s", %s, %s, %s, %s); err != nil`,
+					c.Key,
+					expr,
+					optionalNumber(c.Min),
+					optionalNumber(c.Max),
+					optionalNumber(c.Step)),
+				"err"))
+		}
+
+		if c.Type != "multiline" {
+			snippets = append(snippets, ifReturn(
+				fmt.Sprintf(`err := noNewlinesValidation("%s", %s); err != nil`, c.Key, expr),
+				"err"))
+		}
+	}
+
+	return strings.Join(snippets, "\n"+indent)
+}
+
+// integers are always a whole number away from a whole min, so step 1 would be a no-op
+func (c *CommandFieldSpec) hasStepConstraint() bool {
+	return c.Step != nil && !(*c.Step == 1 && c.stepBase() == math.Trunc(c.stepBase()))
+}
+
+// makes the empty check redundant
+func (c *CommandFieldSpec) minItemsRequiresNonEmpty() bool {
+	return c.MinItems != nil && *c.MinItems > 0
+}
+
+// step counts from min, or from zero if there's no min
+func (c *CommandFieldSpec) stepBase() float64 {
+	if c.Min != nil {
+		return *c.Min
+	}
+
+	return 0
+}
+
+// "a multiple of 5" | "10 plus a multiple of 5"
+func (c *CommandFieldSpec) stepConstraint() string {
+	if c.stepBase() == 0 {
+		return "a multiple of " + formatNumber(*c.Step)
+	}
+
+	return formatNumber(c.stepBase()) + " plus a multiple of " + formatNumber(*c.Step)
+}
+
+// 5 => "5", 0.25 => "0.25"
+func formatNumber(num float64) string {
+	return strconv.FormatFloat(num, 'f', -1, 64)
+}
+
+// Go literal for the field's default value, like `18` or `Color("red")`. "" if no default
+func (c *CommandFieldSpec) goDefaultLiteral(module *Module) (string, error) {
+	if c.Default == nil {
+		return "", nil
+	}
+
+	if c.Type == "list" {
+		items, isList := c.Default.([]interface{})
+		if !isList {
+			return "", errors.New("default must be a list")
+		}
+
+		itemLiterals := []string{}
+		for _, itemDefault := range items {
+			itemSpec := c.listItemSpec()
+			itemSpec.Default = itemDefault
+
+			itemLiteral, err := itemSpec.goDefaultLiteral(module)
+			if err != nil {
+				return "", err
+			}
+
+			itemLiterals = append(itemLiterals, itemLiteral)
+		}
+
+		return c.AsGoType(module) + "{" + strings.Join(itemLiterals, ", ") + "}", nil
+	}
+
+	goType := c.AsGoType(module)
+
+	if enum := module.enumByName(goType); enum != nil {
+		valueLiteral, err := (&CommandFieldSpec{Type: enumBackingFieldType(enum), Default: c.Default}).goDefaultLiteral(module)
+		if err != nil {
+			return "", err
+		}
+
+		if !enum.hasMember((&EnumMemberDef{Value: c.Default}).valueAsString()) {
+			return "", fmt.Errorf("default %v is not a member of %s", c.Default, enum.Name)
+		}
+
+		return goType + "(" + valueLiteral + ")", nil
+	}
+
+	switch goType {
+	case "string":
+		if str, isString := c.Default.(string); isString {
+			return strconv.Quote(str), nil
+		}
+
+		return "", errors.New("default must be a string")
+	case "int":
+		if num, isNumber := c.Default.(float64); isNumber && num == float64(int64(num)) {
+			return formatNumber(num), nil
+		}
+
+		return "", errors.New("default must be a whole number")
+	case "bool":
+		if b, isBool := c.Default.(bool); isBool {
+			return strconv.FormatBool(b), nil
+		}
+
+		return "", errors.New("default must be true or false")
+	default:
+		return "", fmt.Errorf("default not supported for type %s", c.Type)
+	}
+}
+
+// `"foo"` | `18` | ... "" if no default
+func (c *CommandFieldSpec) DefaultJson() string {
+	if c.Default == nil {
+		return ""
+	}
+
+	defaultJson, err := json.Marshal(c.Default)
+	if err != nil { // shouldn't happen, as it came from JSON
+		panic(err)
+	}
+
+	return string(defaultJson)
+}
+
+// "Age: 18, Color: Color("red")"
+func (c *CommandSpec) GoDefaults(module *Module) string {
+	defaults := []string{}
+
+	for _, field := range c.Fields {
+		literal, _ := field.goDefaultLiteral(module) // validated earlier
+		if literal != "" {
+			defaults = append(defaults, field.Key+": "+literal)
+		}
+	}
+
+	return strings.Join(defaults, ", ")
+}
+
+// default max length is 128 (4 KiB for multiline, 2 KiB for URLs)
+func (c *CommandFieldSpec) maxLength() int {
+	switch {
+	case c.MaxLength != nil:
+		return *c.MaxLength
+	case c.Type == "multiline":
+		return 4 * 1024
+	case c.Type == "url":
+		return 2 * 1024
+	default:
+		return 128
+	}
+}
+
+// spec for validating a list's items
+func (c *CommandFieldSpec) listItemSpec() *CommandFieldSpec {
+	return &CommandFieldSpec{
+		Key:             c.Key,
+		Type:            c.ListOf,
+		ValidationRegex: c.ValidationRegex,
+		MaxLength:       c.MaxLength,
+		MinLength:       c.MinLength,
+		Min:             c.Min,
+		Max:             c.Max,
+		Step:            c.Step,
+	}
+}
+
 func (c *CommandFieldSpec) AsGoType(module *Module) string {
 	switch c.Type {
 	case "text":
@@ -184,6 +482,16 @@ func (c *CommandFieldSpec) AsGoType(module *Module) string {
 		return "int"
 	case "date":
 		return "guts.Date"
+	case "datetime":
+		return "time.Time"
+	case "decimal", "email", "url", "uuid":
+		return "string"
+	case "list":
+		if !sliceutil.ContainsString(listItemTypes, c.ListOf) {
+			return ""
+		}
+
+		return "[]" + c.listItemSpec().AsGoType(module)
 	case "custom/string":
 		return "string"
 	case "custom/integer":
@@ -219,6 +527,14 @@ func (c *CommandFieldSpec) AsTsType() string {
 		return "dateRFC3339"
 	case "datetime":
 		return "datetimeRFC3339"
+	case "decimal", "email", "url", "uuid":
+		return "string"
+	case "list":
+		if !sliceutil.ContainsString(listItemTypes, c.ListOf) {
+			return ""
+		}
+
+		return c.listItemSpec().AsTsType() + "[]"
 	case "custom/string":
 		return "string"
 	case "custom/integer":
@@ -272,7 +588,9 @@ func (c *CommandSpec) FieldsForTypeScript(tplData *TplData) string {
 
 		fieldToTypescript := func(fieldSpec *CommandFieldSpec, tsKind string, defValKey string) string {
 			defVal := "undefined" // .. in literal TypeScript code
-			if tsKind == "Checkbox" {
+			if fieldSpec.Default != nil {
+				defVal = fieldSpec.DefaultJson() // JSON literals are valid TypeScript
+			} else if tsKind == "Checkbox" {
 				defVal = "false"
 			}
 
@@ -288,8 +606,38 @@ func (c *CommandSpec) FieldsForTypeScript(tplData *TplData) string {
 				unitJs = fmt.Sprintf("'%s'", escapeStringInsideJsSingleQuotes(fieldSpec.Unit))
 			}
 
-			return fmt.Sprintf(
-				`{ Key: '%s', Title: '%s', Required: %v, HideIfDefaultValue: %v, Kind: c.CommandFieldKind.%s, %s: %s, Help: '%s', Placeholder: '%s', Unit: %s, ValidationRegex: '%s' },`,
+			// only present if relevant, to keep the common case short
+			extraProps := ""
+			if fieldSpec.Type == "list" {
+				extraProps += ", ListItemKind: c.CommandFieldKind." + listItemTsKinds[fieldSpec.ListOf]
+			}
+			if fieldSpec.Min != nil {
+				extraProps += ", Min: " + formatNumber(*fieldSpec.Min)
+			}
+			if fieldSpec.Max != nil {
+				extraProps += ", Max: " + formatNumber(*fieldSpec.Max)
+			}
+			if fieldSpec.Step != nil {
+				extraProps += ", Step: " + formatNumber(*fieldSpec.Step)
+			}
+			if fieldSpec.MinLength != nil {
+				extraProps += fmt.Sprintf(", MinLength: %d", *fieldSpec.MinLength)
+			}
+			if fieldSpec.MinItems != nil {
+				extraProps += fmt.Sprintf(", MinItems: %d", *fieldSpec.MinItems)
+			}
+			if fieldSpec.MaxItems != nil {
+				extraProps += fmt.Sprintf(", MaxItems: %d", *fieldSpec.MaxItems)
+			}
+
+			// JSDoc as documentation for the reader (TypeScript doesn't act on it here)
+			deprecation := ""
+			if fieldSpec.Deprecated.IsDeprecated {
+				deprecation = fieldSpec.Deprecated.TsDoc() + " "
+			}
+
+			return deprecation + fmt.Sprintf(
+				`{ Key: '%s', Title: '%s', Required: %v, HideIfDefaultValue: %v, Kind: c.CommandFieldKind.%s, %s: %s, Help: '%s', Placeholder: '%s', Unit: %s, ValidationRegex: '%s'%s },`,
 				fieldSpec.Key,
 				escapeStringInsideJsSingleQuotes(fieldSpec.Title),
 				!fieldSpec.Optional,
@@ -300,7 +648,8 @@ func (c *CommandSpec) FieldsForTypeScript(tplData *TplData) string {
 				escapeStringInsideJsSingleQuotes(fieldSpec.Help),
 				escapeStringInsideJsSingleQuotes(fieldSpec.Placeholder),
 				unitJs,
-				fieldSpec.ValidationRegex)
+				fieldSpec.ValidationRegex,
+				extraProps)
 		}
 
 		switch fieldSpec.Type {
@@ -316,14 +665,30 @@ func (c *CommandSpec) FieldsForTypeScript(tplData *TplData) string {
 			fieldSerialized = fieldToTypescript(fieldSpec, "Integer", "DefaultValueNumber")
 		case "date":
 			fieldSerialized = fieldToTypescript(fieldSpec, "Date", "DefaultValueString")
+		case "datetime":
+			fieldSerialized = fieldToTypescript(fieldSpec, "DateTime", "DefaultValueString")
+		case "decimal":
+			fieldSerialized = fieldToTypescript(fieldSpec, "Decimal", "DefaultValueString")
+		case "email":
+			fieldSerialized = fieldToTypescript(fieldSpec, "Email", "DefaultValueString")
+		case "url":
+			fieldSerialized = fieldToTypescript(fieldSpec, "Url", "DefaultValueString")
+		case "uuid":
+			fieldSerialized = fieldToTypescript(fieldSpec, "Uuid", "DefaultValueString")
+		case "list":
+			fieldSerialized = fieldToTypescript(fieldSpec, "List", "DefaultValueAny")
 		case "custom/string":
 			fieldSerialized = fieldToTypescript(fieldSpec, "CustomString", "DefaultValueString")
 		case "custom/integer":
 			fieldSerialized = fieldToTypescript(fieldSpec, "CustomInteger", "DefaultValueNumber")
 		default:
 			if isCustomType(fieldSpec.Type) {
-				if tplData.Module.HasEnum(fieldSpec.Type) { // enums as string
-					fieldSerialized = fieldToTypescript(fieldSpec, "Text", "DefaultValueString")
+				if enum := tplData.Module.enumByName(fieldSpec.Type); enum != nil {
+					if enum.IsInteger() {
+						fieldSerialized = fieldToTypescript(fieldSpec, "Integer", "DefaultValueNumber")
+					} else { // enums as string
+						fieldSerialized = fieldToTypescript(fieldSpec, "Text", "DefaultValueString")
+					}
 				} else {
 					fieldSerialized = fieldToTypescript(fieldSpec, "Any", "DefaultValueAny")
 				}
@@ -387,3 +752,126 @@ func escapeStringInsideJsSingleQuotes(in string) string {
 		`'`,
 		`\'`)
 }
+
+// "Id" => "id", "URLPath" => "urlPath", "Type" => "typ" (keywords are not valid identifiers)
+func goParamName(fieldKey string) string {
+	runes := []rune(fieldKey)
+
+	// length of leading uppercase run
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+
+	// "URLPath" => lowercase "UR" but not "LP"'s "P", which begins the next word
+	if upper > 1 && upper < len(runes) {
+		upper--
+	}
+
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	name := string(runes)
+
+	switch name {
+	case "ctx", "c", "cmd", "payload", "opts": // used by generated code
+		return name + "Arg"
+	case "type":
+		return "typ"
+	}
+
+	if token.Lookup(name).IsKeyword() {
+		return name + "Arg"
+	}
+
+	return name
+}
+
+// fields in ctor args' order. these are the typed client's positional parameters
+func (c *CommandSpec) ctorFields() []*CommandFieldSpec {
+	fields := []*CommandFieldSpec{}
+
+	for _, ctorArg := range c.CtorArgs {
+		if field := c.fieldSpecByKey(ctorArg); field != nil {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// fields not in ctor args, in spec order. the typed client takes these via an options struct
+func (c *CommandSpec) ClientOptFields() []*CommandFieldSpec {
+	fields := []*CommandFieldSpec{}
+
+	for _, field := range c.Fields {
+		if !sliceutil.ContainsString(c.CtorArgs, field.Key) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// "name string, age int, opts UserCreateOpts"
+func (c *CommandSpec) GoClientArgs(module *Module) string {
+	args := []string{}
+
+	for _, field := range c.ctorFields() {
+		args = append(args, goParamName(field.Key)+" "+field.AsGoType(module))
+	}
+
+	if len(c.ClientOptFields()) > 0 {
+		args = append(args, "opts "+c.AsGoStructName()+"Opts")
+	}
+
+	return strings.Join(args, ", ")
+}
+
+// type in XxxOpts. nil means not set, so pointer types (structs) are used as-is
+func (c *CommandFieldSpec) GoClientOptType(module *Module) string {
+	goType := c.AsGoType(module)
+	if strings.HasPrefix(goType, "*") {
+		return goType
+	}
+
+	return "*" + goType
+}
+
+// sets ctor args and the options that the caller set both to cmd (for validation) and to
+// payload (what gets sent)
+func (c *CommandSpec) GoClientAssignments(module *Module) string {
+	assignments := []string{}
+
+	for _, field := range c.ctorFields() {
+		assignments = append(assignments, fmt.Sprintf(
+			"cmd.%s = %s\n\tpayload[\"%s\"] = %s",
+			field.Key,
+			goParamName(field.Key),
+			field.Key,
+			goParamName(field.Key)))
+	}
+
+	for _, field := range c.ClientOptFields() {
+		value := "opts." + field.Key
+		if field.GoClientOptType(module) != field.AsGoType(module) {
+			value = "*" + value
+		}
+
+		assignments = append(assignments, fmt.Sprintf(
+			"if opts.%s != nil {\n\t\tcmd.%s = %s\n\t\tpayload[\"%s\"] = %s\n\t}",
+			field.Key,
+			field.Key,
+			value,
+			field.Key,
+			value))
+	}
+
+	return strings.Join(assignments, "\n\t")
+}
+
+// for these the server is expected to tell ID of the created record
+func (c *CommandSpec) ReturnsCreatedRecordId() bool {
+	return c.CrudNature == "create"
+}
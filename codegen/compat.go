@@ -0,0 +1,634 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// difference between two versions of a module's specs
+type SpecChange struct {
+	Module   string // "app/users"
+	Element  string // `command "user.Create" field "Name"`
+	Change   string // "became required"
+	Breaking bool   // breaks existing clients or reading of stored events
+}
+
+// "app/users: command "user.Create" field "Name": became required". also the format for
+// acknowledging a breaking change
+func (s SpecChange) String() string {
+	return s.Module + ": " + s.Element + ": " + s.Change
+}
+
+// returned by CheckBreakingChangesAcknowledged()
+type BreakingChangesError struct {
+	Changes []SpecChange
+}
+
+func (b *BreakingChangesError) Error() string {
+	lines := []string{}
+	for _, change := range b.Changes {
+		lines = append(lines, "  "+change.String())
+	}
+
+	return fmt.Sprintf(
+		"%d breaking change(s) not acknowledged:\n%s",
+		len(b.Changes),
+		strings.Join(lines, "\n"))
+}
+
+// loads both versions of the modules' specs and reports how the new version differs from the
+// old one. modules are matched by their path.
+func CompareModules(oldModules []*Module, newModules []*Module) ([]SpecChange, error) {
+	if err := loadAndValidateModules(oldModules); err != nil {
+		return nil, fmt.Errorf("old version: %w", err)
+	}
+
+	if err := loadAndValidateModules(newModules); err != nil {
+		return nil, fmt.Errorf("new version: %w", err)
+	}
+
+	newByPath := map[string]*Module{}
+	for _, mod := range newModules {
+		newByPath[mod.Path] = mod
+	}
+
+	changes := []SpecChange{}
+
+	for _, oldMod := range oldModules {
+		c := &specComparer{module: oldMod.Path}
+
+		if newMod, found := newByPath[oldMod.Path]; found {
+			c.compareTypes(oldMod, newMod)
+			c.compareEvents(oldMod.Events, newMod.Events)
+			c.compareCommands(*oldMod.Commands, *newMod.Commands)
+			c.compareUiRoutes(oldMod.UiRoutes, newMod.UiRoutes)
+		} else {
+			c.breaking("module", "removed")
+		}
+
+		changes = append(changes, c.changes...)
+	}
+
+	return changes, nil
+}
+
+// acknowledged are SpecChange.String() of breaking changes that were made on purpose. returns
+// *BreakingChangesError if there are other breaking changes
+func CheckBreakingChangesAcknowledged(changes []SpecChange, acknowledged []string) error {
+	isAcknowledged := map[string]bool{}
+	for _, ack := range acknowledged {
+		isAcknowledged[ack] = true
+	}
+
+	unacknowledged := []SpecChange{}
+	for _, change := range changes {
+		if change.Breaking && !isAcknowledged[change.String()] {
+			unacknowledged = append(unacknowledged, change)
+		}
+	}
+
+	if len(unacknowledged) > 0 {
+		return &BreakingChangesError{unacknowledged}
+	}
+
+	return nil
+}
+
+// validation also fills in defaults, which we need for comparing
+func loadAndValidateModules(modules []*Module) error {
+	if err := loadModules(modules); err != nil {
+		return err
+	}
+
+	for _, mod := range modules {
+		if err := mod.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type specComparer struct {
+	module  string
+	changes []SpecChange
+}
+
+func (c *specComparer) breaking(element string, format string, args ...interface{}) {
+	c.add(true, element, format, args...)
+}
+
+func (c *specComparer) compatible(element string, format string, args ...interface{}) {
+	c.add(false, element, format, args...)
+}
+
+func (c *specComparer) add(breaking bool, element string, format string, args ...interface{}) {
+	c.changes = append(c.changes, SpecChange{
+		Module:   c.module,
+		Element:  element,
+		Change:   fmt.Sprintf(format, args...),
+		Breaking: breaking,
+	})
+}
+
+func (c *specComparer) compareTypes(oldMod *Module, newMod *Module) {
+	oldTypes := oldMod.Types
+	newTypes := newMod.Types
+
+	newEnums := map[string]*EnumDef{}
+	for idx := range newTypes.Enums {
+		newEnums[newTypes.Enums[idx].Name] = &newTypes.Enums[idx]
+	}
+
+	for idx := range oldTypes.Enums {
+		oldEnum := &oldTypes.Enums[idx]
+		el := fmt.Sprintf("enum %q", oldEnum.Name)
+
+		newEnum, found := newEnums[oldEnum.Name]
+		delete(newEnums, oldEnum.Name)
+		if !found {
+			c.breaking(el, "removed")
+			continue
+		}
+
+		c.compareEnums(el, oldEnum, newEnum)
+	}
+
+	for _, enum := range newTypes.Enums {
+		if _, added := newEnums[enum.Name]; added {
+			c.compatible(fmt.Sprintf("enum %q", enum.Name), "added")
+		}
+	}
+
+	flows := namedTypeFlows(newMod)
+
+	newNamedTypes := map[string]*DatatypeDef{}
+	for _, namedType := range newTypes.Types {
+		newNamedTypes[namedType.Name] = namedType.Type
+	}
+
+	for _, oldNamedType := range oldTypes.Types {
+		el := fmt.Sprintf("type %q", oldNamedType.Name)
+
+		newType, found := newNamedTypes[oldNamedType.Name]
+		delete(newNamedTypes, oldNamedType.Name)
+		if !found {
+			c.breaking(el, "removed")
+			continue
+		}
+
+		flow := flows[oldNamedType.Name]
+		if flow == 0 { // not used by this module's specs, so treat as before: sent to clients
+			flow = readByOld
+		}
+
+		c.compareDatatypes(el, oldNamedType.Type, newType, flow)
+	}
+
+	for _, namedType := range newTypes.Types {
+		if _, added := newNamedTypes[namedType.Name]; added {
+			c.compatible(fmt.Sprintf("type %q", namedType.Name), "added")
+		}
+	}
+
+	newEndpoints := map[string]*EndpointDefinition{}
+	for idx := range newTypes.Endpoints {
+		newEndpoints[newTypes.Endpoints[idx].Name] = &newTypes.Endpoints[idx]
+	}
+
+	for idx := range oldTypes.Endpoints {
+		oldEndpoint := &oldTypes.Endpoints[idx]
+		el := fmt.Sprintf("endpoint %q", oldEndpoint.Name)
+
+		newEndpoint, found := newEndpoints[oldEndpoint.Name]
+		delete(newEndpoints, oldEndpoint.Name)
+		if !found {
+			c.breaking(el, "removed")
+			continue
+		}
+
+		c.compareEndpoints(el, oldEndpoint, newEndpoint)
+	}
+
+	for _, endpoint := range newTypes.Endpoints {
+		if _, added := newEndpoints[endpoint.Name]; added {
+			c.compatible(fmt.Sprintf("endpoint %q", endpoint.Name), "added")
+		}
+	}
+}
+
+// members are identified by value for string enums and by key for integer enums
+func (c *specComparer) compareEnums(el string, oldEnum *EnumDef, newEnum *EnumDef) {
+	if oldEnum.Type != newEnum.Type {
+		c.breaking(el, "type changed from %s to %s", oldEnum.Type, newEnum.Type)
+		return
+	}
+
+	memberId := func(member EnumMemberDef) string {
+		if oldEnum.IsInteger() {
+			return member.key()
+		}
+
+		return member.valueAsString()
+	}
+
+	newMembers := map[string]EnumMemberDef{}
+	for _, member := range newEnum.AllMembers() {
+		newMembers[memberId(member)] = member
+	}
+
+	for _, oldMember := range oldEnum.AllMembers() {
+		id := memberId(oldMember)
+
+		newMember, found := newMembers[id]
+		delete(newMembers, id)
+		if !found {
+			c.breaking(el, "member %q removed (changes MembersDigest)", id)
+			continue
+		}
+
+		if oldMember.valueAsString() != newMember.valueAsString() {
+			c.breaking(el, "member %q value changed from %s to %s (changes MembersDigest)",
+				id,
+				oldMember.valueAsString(),
+				newMember.valueAsString())
+		}
+	}
+
+	for _, member := range newEnum.AllMembers() {
+		if _, added := newMembers[memberId(member)]; added {
+			c.compatible(el, "member %q added (changes MembersDigest)", memberId(member))
+		}
+	}
+}
+
+func (c *specComparer) compareEndpoints(el string, oldEndpoint *EndpointDefinition, newEndpoint *EndpointDefinition) {
+	if oldEndpoint.Path != newEndpoint.Path {
+		c.breaking(el, "path changed from %q to %q", oldEndpoint.Path, newEndpoint.Path)
+	}
+
+	if oldEndpoint.HttpMethod != newEndpoint.HttpMethod {
+		c.breaking(el, "method changed from %s to %s", oldEndpoint.HttpMethod, newEndpoint.HttpMethod)
+	}
+
+	if oldEndpoint.MiddlewareChain != newEndpoint.MiddlewareChain {
+		c.breaking(el, "chain changed from %q to %q", oldEndpoint.MiddlewareChain, newEndpoint.MiddlewareChain)
+	}
+
+	switch {
+	case oldEndpoint.Produces != nil && newEndpoint.Produces != nil:
+		c.compareDatatypes(el+" produces", oldEndpoint.Produces, newEndpoint.Produces, readByOld)
+	case oldEndpoint.Produces != nil:
+		c.breaking(el, "no longer produces a response body")
+	case newEndpoint.Produces != nil:
+		c.compatible(el, "now produces a response body")
+	}
+
+	switch {
+	case oldEndpoint.Consumes != nil && newEndpoint.Consumes != nil:
+		c.compareDatatypes(el+" consumes", oldEndpoint.Consumes, newEndpoint.Consumes, readByNew)
+	case oldEndpoint.Consumes != nil:
+		c.compatible(el, "no longer consumes a request body")
+	case newEndpoint.Consumes != nil:
+		c.breaking(el, "now requires a request body")
+	}
+}
+
+func (c *specComparer) compareEvents(oldEvents *DomainFile, newEvents *DomainFile) {
+	newByName := map[string]*EventSpec{}
+	for _, event := range newEvents.Events {
+		newByName[event.Event] = event
+	}
+
+	for _, oldEvent := range oldEvents.Events {
+		el := fmt.Sprintf("event %q", oldEvent.Event)
+
+		newEvent, found := newByName[oldEvent.Event]
+		delete(newByName, oldEvent.Event)
+		if !found {
+			c.breaking(el, "removed (stored events of this type could no longer be read)")
+			continue
+		}
+
+		c.compareObjectFields(el, oldEvent.payloadAsDatatype(), newEvent.payloadAsDatatype(), readByNew)
+	}
+
+	for _, event := range newEvents.Events {
+		if _, added := newByName[event.Event]; added {
+			c.compatible(fmt.Sprintf("event %q", event.Event), "added")
+		}
+	}
+}
+
+// which way data moves between the versions. a type can be used both ways
+type dataFlow int
+
+const (
+	readByNew dataFlow = 1 << iota // written by old version: stored events, request bodies from old clients
+	readByOld                      // written by new version: responses to old clients
+)
+
+func (c *specComparer) compareDatatypes(el string, oldType *DatatypeDef, newType *DatatypeDef, flow dataFlow) {
+	if oldType.NameRaw != newType.NameRaw {
+		c.breaking(el, "type changed from %s to %s", oldType.NameRaw, newType.NameRaw)
+		return
+	}
+
+	if oldType.Nullable != newType.Nullable {
+		if newType.Nullable {
+			c.add(flow&readByOld != 0, el, "became nullable") // old readers don't expect null
+		} else {
+			c.add(flow&readByNew != 0, el, "became non-nullable") // old writers may have sent null
+		}
+	}
+
+	switch newType.Name() {
+	case "list":
+		c.compareDatatypes(el+" list item", oldType.Of, newType.Of, flow)
+	case "object":
+		c.compareObjectFields(el, oldType, newType, flow)
+	}
+}
+
+func (c *specComparer) compareObjectFields(el string, oldType *DatatypeDef, newType *DatatypeDef, flow dataFlow) {
+	for _, oldField := range oldType.FieldsSorted() {
+		fieldEl := el + fmt.Sprintf(" field %q", oldField.Key)
+
+		newField, found := newType.Fields[oldField.Key]
+		if !found {
+			// old readers expect it. old writers' data has it, but it's ignored
+			c.add(flow&readByOld != 0, fieldEl, "removed")
+			continue
+		}
+
+		c.compareDatatypes(fieldEl, oldField.Type, newField, flow)
+	}
+
+	for _, newField := range newType.FieldsSorted() {
+		if _, existed := oldType.Fields[newField.Key]; existed {
+			continue
+		}
+
+		fieldEl := el + fmt.Sprintf(" field %q", newField.Key)
+
+		if flow&readByNew != 0 && !newField.Type.Nullable {
+			c.breaking(fieldEl, "added as non-nullable (old data doesn't have it)")
+		} else {
+			c.compatible(fieldEl, "added")
+		}
+	}
+}
+
+func (c *specComparer) compareCommands(oldCommands CommandSpecFile, newCommands CommandSpecFile) {
+	newByName := map[string]*CommandSpec{}
+	for _, cmd := range newCommands {
+		newByName[cmd.Command] = cmd
+	}
+
+	for _, oldCmd := range oldCommands {
+		el := fmt.Sprintf("command %q", oldCmd.Command)
+
+		newCmd, found := newByName[oldCmd.Command]
+		delete(newByName, oldCmd.Command)
+		if !found {
+			c.breaking(el, "removed")
+			continue
+		}
+
+		if oldCmd.MiddlewareChain != newCmd.MiddlewareChain {
+			c.breaking(el, "chain changed from %q to %q", oldCmd.MiddlewareChain, newCmd.MiddlewareChain)
+		}
+
+		c.compareCommandFields(el, oldCmd, newCmd)
+	}
+
+	for _, cmd := range newCommands {
+		if _, added := newByName[cmd.Command]; added {
+			c.compatible(fmt.Sprintf("command %q", cmd.Command), "added")
+		}
+	}
+}
+
+func (c *specComparer) compareCommandFields(el string, oldCmd *CommandSpec, newCmd *CommandSpec) {
+	// clients can leave out the field from the payload
+	omittable := func(field *CommandFieldSpec) bool {
+		return field.Optional || field.Default != nil
+	}
+
+	for _, oldField := range oldCmd.Fields {
+		fieldEl := el + fmt.Sprintf(" field %q", oldField.Key)
+
+		newField := newCmd.fieldSpecByKey(oldField.Key)
+		if newField == nil {
+			// unknown fields are rejected
+			c.breaking(fieldEl, "removed")
+			continue
+		}
+
+		if oldField.Type != newField.Type || oldField.ListOf != newField.ListOf {
+			c.breaking(fieldEl, "type changed from %s to %s", oldField.typeDescription(), newField.typeDescription())
+			continue
+		}
+
+		if omittable(oldField) && !omittable(newField) {
+			c.breaking(fieldEl, "became required")
+		} else if !omittable(oldField) && omittable(newField) {
+			c.compatible(fieldEl, "became optional")
+		}
+
+		if oldField.ValidationRegex != newField.ValidationRegex {
+			c.breaking(fieldEl, "validation_regex changed from %q to %q", oldField.ValidationRegex, newField.ValidationRegex)
+		}
+
+		oldMaxLength, newMaxLength := oldField.maxLength(), newField.maxLength()
+
+		c.compareLimit(fieldEl, "max_length", intAsFloat(&oldMaxLength), intAsFloat(&newMaxLength), true)
+		c.compareLimit(fieldEl, "min_length", intAsFloat(oldField.MinLength), intAsFloat(newField.MinLength), false)
+		c.compareLimit(fieldEl, "min", oldField.Min, newField.Min, false)
+		c.compareLimit(fieldEl, "max", oldField.Max, newField.Max, true)
+		c.compareLimit(fieldEl, "min_items", intAsFloat(oldField.MinItems), intAsFloat(newField.MinItems), false)
+		c.compareLimit(fieldEl, "max_items", intAsFloat(oldField.MaxItems), intAsFloat(newField.MaxItems), true)
+
+		if !floatPtrsEqual(oldField.Step, newField.Step) {
+			c.breaking(fieldEl, "step changed")
+		}
+	}
+
+	for _, newField := range newCmd.Fields {
+		if oldCmd.fieldSpecByKey(newField.Key) != nil {
+			continue
+		}
+
+		fieldEl := el + fmt.Sprintf(" field %q", newField.Key)
+
+		if omittable(newField) {
+			c.compatible(fieldEl, "added")
+		} else {
+			c.breaking(fieldEl, "added as required")
+		}
+	}
+}
+
+// UI routes are bookmarked and linked to, so old URLs must keep working
+func (c *specComparer) compareUiRoutes(oldRoutes []uiRouteSpec, newRoutes []uiRouteSpec) {
+	newById := map[string]*uiRouteSpec{}
+	for idx := range newRoutes {
+		newById[newRoutes[idx].Id] = &newRoutes[idx]
+	}
+
+	// placeholder names aren't part of the URL
+	urlShape := func(route *uiRouteSpec) string {
+		return routePlaceholderParseRe.ReplaceAllString(route.Path, "{}")
+	}
+
+	for idx := range oldRoutes {
+		oldRoute := &oldRoutes[idx]
+		el := fmt.Sprintf("route %q", oldRoute.Id)
+
+		newRoute, found := newById[oldRoute.Id]
+		delete(newById, oldRoute.Id)
+		if !found {
+			c.breaking(el, "removed")
+			continue
+		}
+
+		if urlShape(oldRoute) != urlShape(newRoute) {
+			c.breaking(el, "path changed from %q to %q", oldRoute.Path, newRoute.Path)
+		}
+
+		c.compareUiRouteQueryParams(el, oldRoute, newRoute)
+	}
+
+	for _, route := range newRoutes {
+		if _, added := newById[route.Id]; added {
+			c.compatible(fmt.Sprintf("route %q", route.Id), "added")
+		}
+	}
+}
+
+func (c *specComparer) compareUiRouteQueryParams(el string, oldRoute *uiRouteSpec, newRoute *uiRouteSpec) {
+	newByKey := map[string]uiRouteGoParam{}
+	for _, param := range newRoute.GoQueryParams() {
+		newByKey[param.Key] = param
+	}
+
+	for _, oldParam := range oldRoute.GoQueryParams() {
+		paramEl := fmt.Sprintf("%s query param %q", el, oldParam.Key)
+
+		newParam, found := newByKey[oldParam.Key]
+		delete(newByKey, oldParam.Key)
+		if !found {
+			if oldParam.Nullable {
+				c.compatible(paramEl, "removed")
+			} else {
+				c.breaking(paramEl, "removed (old URLs always carry it)")
+			}
+			continue
+		}
+
+		if oldParam.Integer && !newParam.Integer {
+			c.compatible(paramEl, "type changed from integer to string")
+		} else if !oldParam.Integer && newParam.Integer {
+			c.breaking(paramEl, "type changed from string to integer")
+		}
+
+		if oldParam.Nullable && !newParam.Nullable {
+			c.breaking(paramEl, "became required")
+		} else if !oldParam.Nullable && newParam.Nullable {
+			c.compatible(paramEl, "became optional")
+		}
+	}
+
+	for _, param := range newRoute.GoQueryParams() {
+		if _, added := newByKey[param.Key]; !added {
+			continue
+		}
+
+		paramEl := fmt.Sprintf("%s query param %q", el, param.Key)
+		if param.Nullable {
+			c.compatible(paramEl, "added")
+		} else {
+			c.breaking(paramEl, "added as required")
+		}
+	}
+}
+
+// nil limit means no limit. upper limits are tightened by lowering them.
+func (c *specComparer) compareLimit(el string, name string, oldLimit *float64, newLimit *float64, upper bool) {
+	switch {
+	case floatPtrsEqual(oldLimit, newLimit):
+	case newLimit == nil:
+		c.compatible(el, "%s %s removed", name, formatNumber(*oldLimit))
+	case oldLimit == nil:
+		c.breaking(el, "%s %s added", name, formatNumber(*newLimit))
+	case (*newLimit < *oldLimit) == upper:
+		c.breaking(el, "%s tightened from %s to %s", name, formatNumber(*oldLimit), formatNumber(*newLimit))
+	default:
+		c.compatible(el, "%s loosened from %s to %s", name, formatNumber(*oldLimit), formatNumber(*newLimit))
+	}
+}
+
+// "text" | "list of integer" | "Color"
+func (c *CommandFieldSpec) typeDescription() string {
+	if c.Type == "list" {
+		return "list of " + c.ListOf
+	}
+
+	return c.Type
+}
+
+// this module's named types by how they're used in events and endpoints, directly or via
+// other named types
+func namedTypeFlows(mod *Module) map[string]dataFlow {
+	flows := map[string]dataFlow{}
+
+	var visit func(dt *DatatypeDef, flow dataFlow)
+	visit = func(dt *DatatypeDef, flow dataFlow) {
+		for _, member := range flattenDatatype(dt) {
+			if !member.isCustomType() || member.ModuleId() != "" || flows[member.Name()]&flow != 0 {
+				continue
+			}
+
+			flows[member.Name()] |= flow
+
+			for _, namedType := range mod.Types.Types {
+				if namedType.Name == member.Name() {
+					visit(namedType.Type, flow)
+				}
+			}
+		}
+	}
+
+	for _, event := range mod.Events.Events {
+		visit(event.payloadAsDatatype(), readByNew)
+	}
+
+	for _, endpoint := range mod.Types.Endpoints {
+		if endpoint.Consumes != nil {
+			visit(endpoint.Consumes, readByNew)
+		}
+
+		if endpoint.Produces != nil {
+			visit(endpoint.Produces, readByOld)
+		}
+	}
+
+	return flows
+}
+
+func intAsFloat(num *int) *float64 {
+	if num == nil {
+		return nil
+	}
+
+	asFloat := float64(*num)
+	return &asFloat
+}
+
+func floatPtrsEqual(a *float64, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
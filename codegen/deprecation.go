@@ -0,0 +1,82 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// marks API surface (command, field, event, endpoint, enum member) that is being phased out.
+// in spec either:
+//
+//	"deprecated": true
+//	"deprecated": {"reason": "Collects too much data", "replacement": "user.Register"}
+type Deprecation struct {
+	IsDeprecated bool   `json:"-"`
+	Reason       string `json:"reason"`
+	Replacement  string `json:"replacement"` // name of what to use instead
+}
+
+func (d *Deprecation) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		*d = Deprecation{IsDeprecated: true}
+		return nil
+	case "false":
+		*d = Deprecation{}
+		return nil
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return errors.New("deprecated: expecting true, false or an object")
+	}
+
+	// need a type without our UnmarshalJSON, to not recurse
+	type deprecationDetails Deprecation
+	details := deprecationDetails{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&details); err != nil {
+		return err
+	}
+
+	*d = Deprecation(details)
+	d.IsDeprecated = true
+
+	return nil
+}
+
+// "Collects too much data. Use user.Register instead." "" if not deprecated
+func (d Deprecation) Message() string {
+	if !d.IsDeprecated {
+		return ""
+	}
+
+	sentences := []string{}
+
+	if d.Reason != "" {
+		sentences = append(sentences, strings.TrimSuffix(d.Reason, ".")+".")
+	}
+
+	if d.Replacement != "" {
+		sentences = append(sentences, "Use "+d.Replacement+" instead.")
+	}
+
+	if len(sentences) == 0 {
+		return "Scheduled for removal."
+	}
+
+	// single line, so it's usable in comments
+	return strings.Join(strings.Fields(strings.Join(sentences, " ")), " ")
+}
+
+// "/** @deprecated Use user.Register instead. */" "" if not deprecated
+func (d Deprecation) TsDoc() string {
+	if !d.IsDeprecated {
+		return ""
+	}
+
+	return "/** @deprecated " + strings.ReplaceAll(d.Message(), "*/", "*\\/") + " */"
+}
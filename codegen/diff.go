@@ -0,0 +1,174 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+type diffOp struct {
+	kind byte // ' ' | '-' | '+'
+	line string
+}
+
+// unified diff (like "$ diff -u") of two texts. returns "" if they're equal
+func unifiedDiff(oldName string, newName string, oldText string, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", oldName, newName)
+
+	// line numbers (0-based) in old and new at ops[idx]
+	oldLineAt := make([]int, len(ops)+1)
+	newLineAt := make([]int, len(ops)+1)
+	for idx, op := range ops {
+		oldLineAt[idx+1] = oldLineAt[idx]
+		newLineAt[idx+1] = newLineAt[idx]
+
+		if op.kind != '+' {
+			oldLineAt[idx+1]++
+		}
+		if op.kind != '-' {
+			newLineAt[idx+1]++
+		}
+	}
+
+	idx := 0
+	for idx < len(ops) {
+		if ops[idx].kind == ' ' {
+			idx++
+			continue
+		}
+
+		// found a change. hunk spans from context before it until a run of unchanged lines
+		// long enough to separate it from the next change
+		start := idx - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+
+		end := idx
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+
+			unchangedRun := 0
+			for end+unchangedRun < len(ops) && ops[end+unchangedRun].kind == ' ' {
+				unchangedRun++
+			}
+
+			if end+unchangedRun == len(ops) || unchangedRun > 2*diffContextLines {
+				if unchangedRun > diffContextLines {
+					unchangedRun = diffContextLines
+				}
+
+				end += unchangedRun
+				break
+			}
+
+			end += unchangedRun
+		}
+
+		oldCount := oldLineAt[end] - oldLineAt[start]
+		newCount := newLineAt[end] - newLineAt[start]
+
+		fmt.Fprintf(out, "@@ -%s +%s @@\n",
+			hunkRange(oldLineAt[start], oldCount),
+			hunkRange(newLineAt[start], newCount))
+
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+
+		idx = end
+	}
+
+	return out.String()
+}
+
+// "start,count" with 1-based start. empty range refers to the line before it
+func hunkRange(start0 int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start0)
+	}
+
+	return fmt.Sprintf("%d,%d", start0+1, count)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// longest common subsequence -based diff
+func diffLines(old []string, new []string) []diffOp {
+	// common prefix & suffix are cheap to find and usually make the quadratic part tiny
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+
+	oldMid := old[prefix : len(old)-suffix]
+	newMid := new[prefix : len(new)-suffix]
+
+	// lcs[i][j] = LCS length of oldMid[i:] and newMid[j:]
+	lcs := make([][]int32, len(oldMid)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(newMid)+1)
+	}
+	for i := len(oldMid) - 1; i >= 0; i-- {
+		for j := len(newMid) - 1; j >= 0; j-- {
+			if oldMid[i] == newMid[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []diffOp{}
+	for _, line := range old[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	i, j := 0, 0
+	for i < len(oldMid) || j < len(newMid) {
+		switch {
+		case i < len(oldMid) && j < len(newMid) && oldMid[i] == newMid[j]:
+			ops = append(ops, diffOp{' ', oldMid[i]})
+			i++
+			j++
+		case j < len(newMid) && (i == len(oldMid) || lcs[i][j+1] > lcs[i+1][j]):
+			ops = append(ops, diffOp{'+', newMid[j]})
+			j++
+		default:
+			ops = append(ops, diffOp{'-', oldMid[i]})
+			i++
+		}
+	}
+
+	for _, line := range old[len(old)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	return ops
+}
@@ -3,8 +3,8 @@ package codegen
 import (
 	"crypto/sha1"
 	"encoding/hex"
-	"errors"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -20,28 +20,101 @@ func camelCaseEnumValue(in string) string {
 		-1)
 }
 
-func ProcessStringEnums(enums []EnumDef) []ProcessedStringEnum {
-	processed := []ProcessedStringEnum{}
+// StringMembers shorthand expanded to full member definitions
+func (e *EnumDef) AllMembers() []EnumMemberDef {
+	members := append([]EnumMemberDef{}, e.Members...)
 
-	for _, enum := range enums {
-		if enum.Type != "string" {
-			panic(errors.New("unknown enum type: " + enum.Type))
+	for _, member := range e.StringMembers {
+		members = append(members, EnumMemberDef{Value: member})
+	}
+
+	return members
+}
+
+func (e *EnumDef) IsInteger() bool {
+	return e.Type == "integer"
+}
+
+func (e *EnumDef) hasMemberWithValue(value int) bool {
+	return e.hasMember(strconv.Itoa(value))
+}
+
+// value as in valueAsString()
+func (e *EnumDef) hasMember(value string) bool {
+	for _, member := range e.AllMembers() {
+		if member.valueAsString() == value {
+			return true
 		}
+	}
 
-		members := []ProcessedStringEnumMember{}
+	return false
+}
+
+// command field type for the enum's underlying values
+func enumBackingFieldType(e *EnumDef) string {
+	if e.IsInteger() {
+		return "integer"
+	}
 
-		membersDigest := sha1.Sum([]byte(strings.Join(enum.StringMembers, ",")))
+	return "text"
+}
+
+// "dark_blue" | "2". assumes enum is validated
+func (e *EnumMemberDef) valueAsString() string {
+	switch value := e.Value.(type) {
+	case string:
+		return value
+	case float64: // encoding/json decodes numbers as float64
+		return strconv.FormatInt(int64(value), 10)
+	default:
+		return ""
+	}
+}
 
-		for _, member := range enum.StringMembers {
-			members = append(members, ProcessedStringEnumMember{
-				Key:     camelCaseEnumValue(member),
-				GoKey:   enum.Name + camelCaseEnumValue(member),
-				GoValue: member,
+func (e *EnumMemberDef) key() string {
+	if e.Key != "" {
+		return e.Key
+	}
+
+	return e.valueAsString()
+}
+
+// assumes enums are validated
+func ProcessEnums(enums []EnumDef) []ProcessedEnum {
+	processed := []ProcessedEnum{}
+
+	for _, enum := range enums {
+		members := []ProcessedEnumMember{}
+		digestInputs := []string{}
+
+		for _, member := range enum.AllMembers() {
+			label := member.Label
+			if label == "" {
+				label = member.key()
+			}
+
+			members = append(members, ProcessedEnumMember{
+				SpecKey:     member.key(),
+				Key:         camelCaseEnumValue(member.key()),
+				GoKey:       enum.Name + camelCaseEnumValue(member.key()),
+				GoValue:     member.valueAsString(),
+				Label:       label,
+				Description: member.Description,
+				Deprecated:  member.Deprecated,
 			})
+
+			if enum.IsInteger() {
+				digestInputs = append(digestInputs, member.key()+"="+member.valueAsString())
+			} else {
+				digestInputs = append(digestInputs, member.valueAsString())
+			}
 		}
 
-		processed = append(processed, ProcessedStringEnum{
+		membersDigest := sha1.Sum([]byte(strings.Join(digestInputs, ",")))
+
+		processed = append(processed, ProcessedEnum{
 			Name:          enum.Name,
+			Integer:       enum.IsInteger(),
 			MembersDigest: hex.EncodeToString(membersDigest[:])[0:6],
 			Members:       members,
 		})
@@ -49,3 +122,15 @@ func ProcessStringEnums(enums []EnumDef) []ProcessedStringEnum {
 
 	return processed
 }
+
+// Deprecated: use ProcessEnums. integer-backed enums are left out.
+func ProcessStringEnums(enums []EnumDef) []ProcessedStringEnum {
+	stringEnums := []EnumDef{}
+	for _, enum := range enums {
+		if !enum.IsInteger() {
+			stringEnums = append(stringEnums, enum)
+		}
+	}
+
+	return ProcessEnums(stringEnums)
+}
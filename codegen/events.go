@@ -184,8 +184,139 @@ func ProcessEvents(file *DomainFile) ([]EventDefForTpl, string) {
 			GoStructName:    EventNameAsGoStructName(eventSpec),
 			CtorArgs:        strings.Join(ctorArgs, ", "),
 			CtorAssignments: strings.Join(ctorAssignments, "\n\t\t"),
+			Deprecated:      eventSpec.Deprecated,
 		})
 	}
 
 	return eventDefs, structsVisitor.AsGoCode()
 }
+
+// "UserCreated"
+func (e *EventSpec) GoStructName() string {
+	return EventNameAsGoStructName(e)
+}
+
+// "Name: string;\n\tAge: number;"
+func (e *EventSpec) TsFields() string {
+	fields := []string{}
+
+	for _, field := range e.Fields {
+		fields = append(fields, field.Key+": "+field.Type.AsTypeScriptType()+";")
+	}
+
+	return strings.Join(fields, "\n\t")
+}
+
+// JS literal describing the payload's shape, for the generated TypeScript decoder
+func (e *EventSpec) TsPayloadSchema(module *Module) string {
+	return tsSchema(e.payloadAsDatatype(), module, map[string]bool{})
+}
+
+// this module's custom types that events refer to, for importing in TypeScript
+func (d *DomainFile) TsImportedCustomTypes() []string {
+	customTypes := map[string]bool{}
+
+	for _, event := range d.Events {
+		for _, dt := range flattenDatatype(event.payloadAsDatatype()) {
+			if dt.isCustomType() && dt.ModuleId() == "" {
+				customTypes[dt.Name()] = true
+			}
+		}
+	}
+
+	return stringBoolMapKeysSorted(customTypes)
+}
+
+// "\tPerson: { kind: 'object', ... },\n" for each named type (from types spec) that events
+// refer to, directly or via other named types
+func (d *DomainFile) TsNamedTypeSchemas(module *Module) string {
+	referenced := map[string]bool{}
+	for _, event := range d.Events {
+		tsSchema(event.payloadAsDatatype(), module, referenced)
+	}
+
+	schemas := map[string]string{}
+
+	// schemas can refer to further named types
+	for len(schemas) < len(referenced) {
+		for _, name := range stringBoolMapKeysSorted(referenced) {
+			if _, done := schemas[name]; done {
+				continue
+			}
+
+			schemas[name] = "{ kind: 'any' }" // in case it's not defined (validation catches that)
+
+			for _, namedType := range module.Types.Types {
+				if namedType.Name == name {
+					schemas[name] = tsSchema(namedType.Type, module, referenced)
+				}
+			}
+		}
+	}
+
+	lines := []string{}
+	for _, name := range stringBoolMapKeysSorted(referenced) {
+		lines = append(lines, "\t"+name+": "+schemas[name]+",")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// event's fields as an object datatype
+func (e *EventSpec) payloadAsDatatype() *DatatypeDef {
+	fields := map[string]*DatatypeDef{}
+	for _, field := range e.Fields {
+		fields[field.Key] = &field.Type
+	}
+
+	return &DatatypeDef{NameRaw: "object", Fields: fields}
+}
+
+// JS literal of the Schema interface in generated events.ts. names of this module's named
+// types that it refers to are added to referencedTypes
+func tsSchema(dt *DatatypeDef, module *Module, referencedTypes map[string]bool) string {
+	schema := ""
+
+	switch {
+	case dt.isCustomType():
+		if enum := module.enumByName(dt.NameRaw); enum != nil { // also other modules' enums
+			values := []string{}
+			for _, member := range enum.AllMembers() {
+				if enum.IsInteger() {
+					values = append(values, member.valueAsString())
+				} else {
+					values = append(values, "'"+escapeStringInsideJsSingleQuotes(member.valueAsString())+"'")
+				}
+			}
+
+			schema = "{ kind: 'oneOf', values: [" + strings.Join(values, ", ") + "] }"
+		} else if dt.ModuleId() != "" { // other modules' structs are not checked
+			schema = "{ kind: 'any' }"
+		} else {
+			referencedTypes[dt.Name()] = true
+
+			schema = "{ kind: 'ref', ref: '" + dt.Name() + "' }"
+		}
+	case dt.Name() == "integer":
+		schema = "{ kind: 'integer' }"
+	case dt.Name() == "boolean":
+		schema = "{ kind: 'boolean' }"
+	case dt.Name() == "list":
+		schema = "{ kind: 'list', of: " + tsSchema(dt.Of, module, referencedTypes) + " }"
+	case dt.Name() == "object":
+		fields := []string{}
+		for _, field := range dt.FieldsSorted() {
+			fields = append(fields, field.Key+": "+tsSchema(field.Type, module, referencedTypes))
+		}
+
+		schema = "{ kind: 'object', fields: { " + strings.Join(fields, ", ") + " } }"
+	default: // string, date, datetime, binary
+		schema = "{ kind: 'string' }"
+	}
+
+	if dt.Nullable {
+		schema = "{ kind: 'nullable', of: " + schema + " }"
+	}
+
+	return schema
+}
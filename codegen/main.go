@@ -7,7 +7,6 @@ import (
 	"regexp"
 
 	"github.com/function61/eventkit/codegen/codegentemplates"
-	"github.com/function61/gokit/encoding/jsonfile"
 	"github.com/function61/gokit/sliceutil"
 )
 
@@ -27,16 +26,53 @@ type Module struct {
 	Types    *ApplicationTypesDefinition
 	Commands *CommandSpecFile
 	UiRoutes []uiRouteSpec
+
+	specPositions map[string]*specPositions // spec file => positions of things in it
+	otherModules  map[string]*Module        // by Id, for resolving "module.Type" references
 }
 
+// name is "Type" | "module.Type"
 func (m *Module) HasEnum(name string) bool {
-	for _, enumDef := range m.Types.Enums {
-		if enumDef.Name == name {
-			return true
+	return m.enumByName(name) != nil
+}
+
+// name is "Type" | "module.Type"
+func (m *Module) enumByName(name string) *EnumDef {
+	mod, typeName := m.resolveTypeRef(name)
+	if mod == nil {
+		return nil
+	}
+
+	for idx := range mod.Types.Enums {
+		if mod.Types.Enums[idx].Name == typeName {
+			return &mod.Types.Enums[idx]
 		}
 	}
 
-	return false
+	return nil
+}
+
+// "Color" => (m, "Color"), "domain.Color" => (domain, "Color"). module is nil if it's not
+// part of this codegen run, in which case we don't know anything about its types
+func (m *Module) resolveTypeRef(ref string) (*Module, string) {
+	dt := &DatatypeDef{NameRaw: ref}
+
+	switch moduleId := dt.ModuleId(); moduleId {
+	case "", m.Id:
+		return m, dt.Name()
+	default:
+		return m.otherModules[moduleId], dt.Name()
+	}
+}
+
+// "domain" => "shared/domain", for imports. referenced modules that are not part of this codegen
+// run are assumed to live at their ID
+func (m *Module) ImportedModulePath(moduleId string) string {
+	if other, found := m.otherModules[moduleId]; found {
+		return other.Path
+	}
+
+	return moduleId
 }
 
 var moduleIdFromModulePathRe = regexp.MustCompile("[^/]+$")
@@ -66,45 +102,78 @@ type FileToGenerate struct {
 	obtainTemplate func() (string, error)
 }
 
-func processModule(mod *Module, opts Opts) error {
+// reads the module's spec files
+func loadModule(mod *Module) error {
 	// should be ok with nil data
 	mod.Events = &DomainFile{}
 	mod.Types = &ApplicationTypesDefinition{}
 	mod.Commands = &CommandSpecFile{}
+	mod.specPositions = map[string]*specPositions{}
 
-	hasTypes := mod.TypesFile != ""
-	hasEvents := mod.EventsSpecFile != ""
-	hasCommands := mod.CommandsSpecFile != ""
-	hasUiRoutes := mod.UiRoutesFile != ""
-
-	if hasEvents {
-		if err := jsonfile.ReadDisallowUnknownFields(mod.EventsSpecFile, mod.Events); err != nil {
+	load := func(path string, data interface{}) error {
+		positions, err := loadSpecFile(path, data)
+		if err != nil {
 			return err
 		}
+
+		mod.specPositions[path] = positions
+		return nil
 	}
 
-	if hasTypes {
-		if err := jsonfile.ReadDisallowUnknownFields(mod.TypesFile, mod.Types); err != nil {
+	if mod.EventsSpecFile != "" {
+		if err := load(mod.EventsSpecFile, mod.Events); err != nil {
 			return err
 		}
-		if err := mod.Types.Validate(); err != nil {
+	}
+
+	if mod.TypesFile != "" {
+		if err := load(mod.TypesFile, mod.Types); err != nil {
 			return err
 		}
 	}
 
-	if hasCommands {
-		if err := jsonfile.ReadDisallowUnknownFields(mod.CommandsSpecFile, mod.Commands); err != nil {
+	if mod.CommandsSpecFile != "" {
+		if err := load(mod.CommandsSpecFile, mod.Commands); err != nil {
 			return err
 		}
-		if err := mod.Commands.Validate(mod); err != nil {
+	}
+
+	if mod.UiRoutesFile != "" {
+		if err := load(mod.UiRoutesFile, &mod.UiRoutes); err != nil {
 			return err
 		}
 	}
 
-	if hasUiRoutes {
-		if err := jsonfile.ReadDisallowUnknownFields(mod.UiRoutesFile, &mod.UiRoutes); err != nil {
+	return nil
+}
+
+// all modules are loaded first, so that they can refer to each others' types
+func loadModules(modules []*Module) error {
+	modulesById := map[string]*Module{}
+	for _, mod := range modules {
+		if err := loadModule(mod); err != nil {
 			return err
 		}
+
+		modulesById[mod.Id] = mod
+	}
+
+	for _, mod := range modules {
+		mod.otherModules = modulesById
+	}
+
+	return nil
+}
+
+// validates a loaded module and generates its files
+func processModule(mod *Module, opts Opts, staleFiles *[]StaleFile) error {
+	hasTypes := mod.TypesFile != ""
+	hasEvents := mod.EventsSpecFile != ""
+	hasCommands := mod.CommandsSpecFile != ""
+	hasUiRoutes := mod.UiRoutesFile != ""
+
+	if err := mod.Validate(); err != nil {
+		return err
 	}
 
 	hasRestEndpoints := len(mod.Types.Endpoints) > 0
@@ -122,16 +191,23 @@ func processModule(mod *Module, opts Opts) error {
 
 	eventsImports := NewImports()
 
+	eventsDatatypes := []*DatatypeDef{}
 	for _, eventDef := range mod.Events.Events {
 		for _, field := range eventDef.Fields {
-			for _, datatype := range flattenDatatype(&field.Type) {
-				switch datatype.NameRaw {
-				case "date":
-					eventsImports.Date = true
-				case "datetime":
-					eventsImports.DateTime = true
-				}
-			}
+			eventsDatatypes = append(eventsDatatypes, flattenDatatype(&field.Type)...)
+		}
+	}
+
+	eventsImports.ModuleIds = uniqueModuleIdsFromDatatypes(eventsDatatypes)
+
+	for _, datatype := range eventsDatatypes {
+		switch datatype.NameRaw {
+		case "date":
+			eventsImports.Date = true
+		case "datetime":
+			eventsImports.DateTime = true
+		case "binary":
+			eventsImports.Binary = true
 		}
 	}
 
@@ -154,18 +230,38 @@ func processModule(mod *Module, opts Opts) error {
 		}
 	}
 
+	commandsDatatypes := []*DatatypeDef{}
+	commandsCtorDatatypes := []*DatatypeDef{}
+
 	for _, command := range *mod.Commands {
 		for _, field := range command.Fields {
-			if field.Type == "date" {
+			inCtor := sliceutil.ContainsString(command.CtorArgs, field.Key)
+
+			commandsDatatypes = append(commandsDatatypes, &DatatypeDef{NameRaw: field.Type})
+			if inCtor {
+				commandsCtorDatatypes = append(commandsCtorDatatypes, &DatatypeDef{NameRaw: field.Type})
+			}
+
+			switch field.Type {
+			case "date":
 				commandsImports.Date = true
 
-				if sliceutil.ContainsString(command.CtorArgs, field.Key) {
+				if inCtor {
 					commandsImportsUi.Date = true
 				}
+			case "datetime":
+				commandsImports.DateTime = true
+
+				if inCtor {
+					commandsImportsUi.DateTime = true
+				}
 			}
 		}
 	}
 
+	commandsImports.ModuleIds = uniqueModuleIdsFromDatatypes(commandsDatatypes)
+	commandsImportsUi.ModuleIds = uniqueModuleIdsFromDatatypes(commandsCtorDatatypes)
+
 	backendPath := func(file string) string {
 		return "pkg/" + mod.Path + "/" + file
 	}
@@ -186,6 +282,7 @@ func processModule(mod *Module, opts Opts) error {
 		CommandsImports:        commandsImports,
 		CommandsImportsUi:      commandsImportsUi,
 		EventsImports:          eventsImports,
+		Enums:                  ProcessEnums(mod.Types.Enums),
 		StringEnums:            ProcessStringEnums(mod.Types.Enums),
 		EventDefs:              eventDefs,
 		EventStructsAsGoCode:   eventStructsAsGoCode,
@@ -196,6 +293,10 @@ func processModule(mod *Module, opts Opts) error {
 			return nil
 		}
 
+		if opts.CheckOnly {
+			return checkFile(Inline(path, template), data, staleFiles)
+		}
+
 		return ProcessFile(Inline(path, template), data)
 	}
 
@@ -203,10 +304,12 @@ func processModule(mod *Module, opts Opts) error {
 
 	return allOk(
 		renderOneIf(hasCommands, backendPath("commanddefinitions.gen.go"), codegentemplates.BackendCommandsDefinitions),
+		renderOneIf(hasCommands, backendPath("commandclient.gen.go"), codegentemplates.BackendCommandClient),
 		renderOneIf(hasCommands, frontendPath("commands.ts"), codegentemplates.FrontendCommandDefinitions),
 		renderOneIf(hasCommands && docs, docPath("commands.md"), codegentemplates.DocsCommands),
 		renderOneIf(hasEvents, backendPath("events.gen.go"), codegentemplates.BackendEventDefinitions),
 		renderOneIf(hasEvents && docs, docPath("events.md"), codegentemplates.DocsEvents),
+		renderOneIf(hasEvents, frontendPath("events.ts"), codegentemplates.FrontendEvents),
 		renderOneIf(hasRestEndpoints, frontendPath("endpoints.ts"), codegentemplates.FrontendRestEndpoints),
 		renderOneIf(hasRestEndpoints, backendPath("restendpoints.gen.go"), codegentemplates.BackendRestEndpoints),
 		renderOneIf(hasRestEndpoints && docs, docPath("rest_endpoints.md"), codegentemplates.DocsRestEndpoints),
@@ -214,6 +317,7 @@ func processModule(mod *Module, opts Opts) error {
 		renderOneIf(hasTypes, frontendPath("types.ts"), codegentemplates.FrontendDatatypes),
 		renderOneIf(hasTypes && docs, docPath("types.md"), codegentemplates.DocsTypes),
 		renderOneIf(hasUiRoutes, backendPath("ui-routes.gen.go"), codegentemplates.BackendUiRoutes),
+		renderOneIf(hasUiRoutes && !opts.NoGorillaMux, backendPath("ui-routes-mux.gen.go"), codegentemplates.BackendUiRoutesGorillaMux),
 		renderOneIf(hasUiRoutes, frontendPath("uiroutes.ts"), codegentemplates.FrontendUiRoutes),
 	)
 }
@@ -222,15 +326,29 @@ type Opts struct {
 	BackendModulePrefix    string // "github.com/myorg/myproject/pkg/"
 	FrontendModulePrefix   string // "generated/"
 	AutogenerateModuleDocs bool
+	// don't write anything, but return *StaleFilesError if any generated file would change
+	CheckOnly bool
+	// leave out RegisterUiRoutes() (the gorilla/mux adapter) for projects that don't use it
+	NoGorillaMux bool
 }
 
 func ProcessModules(modules []*Module, opts Opts) error {
+	staleFiles := []StaleFile{}
+
+	if err := loadModules(modules); err != nil {
+		return err
+	}
+
 	for _, mod := range modules {
-		if err := processModule(mod, opts); err != nil {
+		if err := processModule(mod, opts, &staleFiles); err != nil {
 			return err
 		}
 	}
 
+	if len(staleFiles) > 0 {
+		return &StaleFilesError{staleFiles}
+	}
+
 	return nil
 }
 
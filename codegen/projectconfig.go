@@ -0,0 +1,108 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/function61/gokit/encoding/jsonfile"
+)
+
+// declarative alternative to calling NewModule() and ProcessModules() from your own main.go.
+// looks like:
+//
+//	{
+//		"backend_module_prefix": "github.com/myorg/myproject/pkg/",
+//		"frontend_module_prefix": "generated/",
+//		"autogenerate_module_docs": true,
+//		"no_gorilla_mux": false,
+//		"modules": [
+//			{
+//				"path": "vstoserver/vstotypes",
+//				"types": "pkg/vstoserver/vstotypes/types.json",
+//				"commands": "pkg/vstoserver/vstotypes/commands.json"
+//			}
+//		]
+//	}
+type ProjectConfig struct {
+	BackendModulePrefix    string                `json:"backend_module_prefix"`
+	FrontendModulePrefix   string                `json:"frontend_module_prefix"`
+	AutogenerateModuleDocs bool                  `json:"autogenerate_module_docs"`
+	NoGorillaMux           bool                  `json:"no_gorilla_mux"` // see Opts.NoGorillaMux
+	Modules                []ProjectConfigModule `json:"modules"`
+}
+
+// spec file paths are optional, but at least one is required
+type ProjectConfigModule struct {
+	Path     string `json:"path"` // "vstoserver/vstotypes"
+	Types    string `json:"types"`
+	Events   string `json:"events"`
+	Commands string `json:"commands"`
+	UiRoutes string `json:"ui_routes"`
+}
+
+func LoadProjectConfig(path string) (*ProjectConfig, error) {
+	conf := &ProjectConfig{}
+	if err := jsonfile.ReadDisallowUnknownFields(path, conf); err != nil {
+		return nil, err
+	}
+
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return conf, nil
+}
+
+func (p *ProjectConfig) Validate() error {
+	if len(p.Modules) == 0 {
+		return fmt.Errorf("no modules defined")
+	}
+
+	// module ID is the package name of generated code, and it keys cross-module type references
+	pathsById := map[string]string{}
+
+	for idx, mod := range p.Modules {
+		if mod.Path == "" {
+			return fmt.Errorf("modules[%d]: path empty", idx)
+		}
+
+		id := moduleIdFromModulePathRe.FindString(mod.Path)
+		if id == "" {
+			return fmt.Errorf("module %s: path must end with module name", mod.Path)
+		}
+
+		if otherPath, dup := pathsById[id]; dup {
+			return fmt.Errorf("module %s: ID %q already used by module %s", mod.Path, id, otherPath)
+		}
+		pathsById[id] = mod.Path
+
+		if mod.Types == "" && mod.Events == "" && mod.Commands == "" && mod.UiRoutes == "" {
+			return fmt.Errorf("module %s: no spec files", mod.Path)
+		}
+	}
+
+	return nil
+}
+
+func (p *ProjectConfig) Opts() Opts {
+	return Opts{
+		BackendModulePrefix:    p.BackendModulePrefix,
+		FrontendModulePrefix:   p.FrontendModulePrefix,
+		AutogenerateModuleDocs: p.AutogenerateModuleDocs,
+		NoGorillaMux:           p.NoGorillaMux,
+	}
+}
+
+func (p *ProjectConfig) ToModules() []*Module {
+	modules := []*Module{}
+
+	for _, mod := range p.Modules {
+		modules = append(modules, NewModule(
+			mod.Path,
+			mod.Types,
+			mod.Events,
+			mod.Commands,
+			mod.UiRoutes))
+	}
+
+	return modules
+}
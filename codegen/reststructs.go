@@ -44,6 +44,7 @@ type EndpointDefinition struct {
 	Description     string       `json:"description"`
 	Produces        *DatatypeDef `json:"produces"` // optional
 	Consumes        *DatatypeDef `json:"consumes"` // optional
+	Deprecated      Deprecation  `json:"deprecated"`
 }
 
 // "/users/{id}" => "/users/${encodeURIComponent(id)}"
@@ -60,23 +61,39 @@ func (e *EndpointDefinition) TypescriptPath() string {
 	return strings.NewReplacer(replacements...).Replace(e.Path)
 }
 
-// FIXME: URL escaping
-// "/users/{id}" => "/users/"+id+""
-// "/search?q={query}" => "/search?query="+query+""
+// "/users/{id}" => "/users/"+pathEscape(id)+""
+// "/search?q={query}" => "/search?q="+queryEscape(query)+""
 func (e *EndpointDefinition) GoPath() string {
+	path, query := e.Path, ""
+	if pos := strings.Index(path, "?"); pos != -1 {
+		path, query = e.Path[:pos], e.Path[pos:]
+	}
+
+	return goPathEscaped(path, "pathEscape") + goPathEscaped(query, "queryEscape")
+}
+
+func goPathEscaped(path string, escapeFn string) string {
 	replacements := []string{}
 
-	for _, item := range routePlaceholderParseRe.FindAllStringSubmatch(e.Path, -1) {
+	for _, item := range routePlaceholderParseRe.FindAllStringSubmatch(path, -1) {
 		replacements = append(replacements,
 			item[0],
-			"\"+queryEscape("+item[1]+")+\"")
+			"\"+"+escapeFn+"("+item[1]+")+\"")
 	}
 
-	return strings.NewReplacer(replacements...).Replace(e.Path)
+	return strings.NewReplacer(replacements...).Replace(path)
 }
 
 var routePlaceholderParseRe = regexp.MustCompile(`\{([a-zA-Z0-9]+)\}`)
 
+// identifiers in generated client methods (receiver, params, locals) that placeholders would shadow
+var endpointClientReservedNames = map[string]bool{
+	"r":      true,
+	"ctx":    true,
+	"body":   true,
+	"output": true,
+}
+
 // "/users/{id}/addresses/{idx}" => "id: string, idx: string"
 func (e *EndpointDefinition) TypescriptArgs() string {
 	args := []string{}
@@ -101,6 +118,21 @@ func (e *EndpointDefinition) GoArgs() string {
 	return strings.Join(args, ", ")
 }
 
+// "/users/{id}" with consumes => "ctx context.Context, id string, body User"
+func (e *EndpointDefinition) GoClientArgs() string {
+	args := []string{"ctx context.Context"}
+
+	if pathArgs := e.GoArgs(); pathArgs != "" {
+		args = append(args, pathArgs)
+	}
+
+	if e.Consumes != nil {
+		args = append(args, "body "+e.Consumes.AsGoType())
+	}
+
+	return strings.Join(args, ", ")
+}
+
 type NamedDatatypeDef struct {
 	Name string       `json:"name"`
 	Type *DatatypeDef `json:"type"`
@@ -166,6 +198,13 @@ func (d *DatatypeDef) AsTypeScriptType() string {
 			tsType = "binaryBase64"
 		case "list":
 			tsType = d.Of.AsTypeScriptType() + "[]"
+		case "object": // inline
+			fields := []string{}
+			for _, field := range d.FieldsSorted() {
+				fields = append(fields, field.Key+": "+field.Type.AsTypeScriptType()+";")
+			}
+
+			tsType = "{ " + strings.Join(fields, " ") + " }"
 		default:
 			panic("unknown type for TypeScript: " + d.Name())
 		}
@@ -0,0 +1,299 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// where things are in a spec file, so errors can be reported as "file:line:col: message"
+// (which editors know how to jump to)
+type specPositions struct {
+	content []byte
+	offsets map[string]int // JSON pointer ("/3/fields/2") => byte offset
+}
+
+// position of the element at JSON pointer. for object members it's the position of the key.
+// if the element isn't in the file (like a missing "type"), its closest ancestor's position is
+// used. ok=false if unknown (e.g. module built in-memory instead of loaded from file)
+func (s *specPositions) lookup(pointer string) (int, int, bool) {
+	if s == nil {
+		return 0, 0, false
+	}
+
+	for {
+		if offset, found := s.offsets[pointer]; found {
+			line, col := s.lineAndCol(offset)
+			return line, col, true
+		}
+
+		if pointer == "" {
+			return 0, 0, false
+		}
+
+		pointer = pointer[:strings.LastIndexByte(pointer, '/')]
+	}
+}
+
+// 1-based
+func (s *specPositions) lineAndCol(offset int) (int, int) {
+	if offset > len(s.content) {
+		offset = len(s.content)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	before := s.content[:offset]
+
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+
+	return bytes.Count(before, []byte{'\n'}) + 1, utf8.RuneCount(before[lineStart:]) + 1
+}
+
+// like jsonfile.ReadDisallowUnknownFields(), but errors carry the position in the file
+func loadSpecFile(path string, data interface{}) (*specPositions, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := &specPositions{
+		content: content,
+		offsets: map[string]int{},
+	}
+
+	errAt := func(offset int, err error) error {
+		line, col := positions.lineAndCol(offset)
+		return SpecError{File: path, Line: line, Col: col, Problem: err.Error()}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	errDecode := decoder.Decode(data)
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(errDecode, &syntaxErr) { // can't index positions of a malformed document
+		// offset is just past the offending byte
+		return nil, errAt(int(syntaxErr.Offset)-1, errDecode)
+	}
+
+	scanner := &specScanner{content: content, offsets: positions.offsets, unknownKeyOffset: -1}
+	if err := scanner.value("", reflect.TypeOf(data)); err != nil {
+		return nil, errAt(scanner.pos, err)
+	}
+
+	if errDecode != nil {
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(errDecode, &typeErr):
+			return nil, errAt(int(typeErr.Offset), errDecode)
+		case scanner.unknownKeyOffset != -1: // "json: unknown field ..."
+			return nil, errAt(scanner.unknownKeyOffset, errDecode)
+		default:
+			return nil, SpecError{File: path, Problem: errDecode.Error()}
+		}
+	}
+
+	return positions, nil
+}
+
+// records offsets of values in a JSON document by their JSON pointer. follows along the Go
+// type that the document is decoded to, to find the first key that the decoder would
+// reject as unknown.
+type specScanner struct {
+	content          []byte
+	pos              int
+	offsets          map[string]int
+	unknownKeyOffset int
+}
+
+func (s *specScanner) value(pointer string, typ reflect.Type) error {
+	s.skipWhitespace()
+
+	if _, recorded := s.offsets[pointer]; !recorded { // object members record their key's offset
+		s.offsets[pointer] = s.pos
+	}
+
+	if s.pos >= len(s.content) {
+		return errors.New("unexpected end of JSON input")
+	}
+
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch s.content[s.pos] {
+	case '{':
+		s.pos++
+
+		for idx := 0; ; idx++ {
+			s.skipWhitespace()
+			if s.peek('}') {
+				s.pos++
+				return nil
+			}
+
+			if idx > 0 {
+				if err := s.expect(','); err != nil {
+					return err
+				}
+				s.skipWhitespace()
+			}
+
+			keyOffset := s.pos
+
+			key, err := s.string()
+			if err != nil {
+				return err
+			}
+
+			s.skipWhitespace()
+			if err := s.expect(':'); err != nil {
+				return err
+			}
+
+			memberPointer := pointer + "/" + escapeJsonPointerToken(key)
+			s.offsets[memberPointer] = keyOffset
+
+			memberType, known := memberTypeOf(typ, key)
+			if !known && s.unknownKeyOffset == -1 {
+				s.unknownKeyOffset = keyOffset
+			}
+
+			if err := s.value(memberPointer, memberType); err != nil {
+				return err
+			}
+		}
+	case '[':
+		s.pos++
+
+		var itemType reflect.Type
+		if typ != nil && (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) {
+			itemType = typ.Elem()
+		}
+
+		for idx := 0; ; idx++ {
+			s.skipWhitespace()
+			if s.peek(']') {
+				s.pos++
+				return nil
+			}
+
+			if idx > 0 {
+				if err := s.expect(','); err != nil {
+					return err
+				}
+			}
+
+			if err := s.value(pointer+"/"+strconv.Itoa(idx), itemType); err != nil {
+				return err
+			}
+		}
+	case '"':
+		_, err := s.string()
+		return err
+	default: // number, true, false, null
+		for s.pos < len(s.content) && !strings.ContainsRune(",]} \t\r\n", rune(s.content[s.pos])) {
+			s.pos++
+		}
+
+		return nil
+	}
+}
+
+func (s *specScanner) string() (string, error) {
+	start := s.pos
+
+	if err := s.expect('"'); err != nil {
+		return "", err
+	}
+
+	for s.pos < len(s.content) {
+		switch s.content[s.pos] {
+		case '\\':
+			s.pos += 2
+		case '"':
+			s.pos++
+
+			var str string
+			err := json.Unmarshal(s.content[start:s.pos], &str)
+			return str, err
+		default:
+			s.pos++
+		}
+	}
+
+	return "", errors.New("unexpected end of JSON input")
+}
+
+func (s *specScanner) skipWhitespace() {
+	for s.pos < len(s.content) && strings.ContainsRune(" \t\r\n", rune(s.content[s.pos])) {
+		s.pos++
+	}
+}
+
+func (s *specScanner) peek(ch byte) bool {
+	return s.pos < len(s.content) && s.content[s.pos] == ch
+}
+
+func (s *specScanner) expect(ch byte) error {
+	if !s.peek(ch) {
+		return errors.New("expecting " + string(ch))
+	}
+
+	s.pos++
+	return nil
+}
+
+// type of object member "key" when decoding to typ. known=false if encoding/json would reject
+// the key as unknown. nil type means we don't know (or care), and nothing inside is checked
+func memberTypeOf(typ reflect.Type, key string) (reflect.Type, bool) {
+	if typ == nil {
+		return nil, true
+	}
+
+	switch typ.Kind() {
+	case reflect.Map:
+		return typ.Elem(), true
+	case reflect.Struct:
+		// same matching rules as encoding/json: exact match preferred, then case-insensitive
+		var caseInsensitiveMatch reflect.Type
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" { // unexported
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			if name == key {
+				return field.Type, true
+			}
+
+			if caseInsensitiveMatch == nil && strings.EqualFold(name, key) {
+				caseInsensitiveMatch = field.Type
+			}
+		}
+
+		return caseInsensitiveMatch, caseInsensitiveMatch != nil
+	default:
+		return nil, true
+	}
+}
+
+// "a/b" => "a~1b" (RFC 6901)
+func escapeJsonPointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
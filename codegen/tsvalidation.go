@@ -0,0 +1,250 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TypeScript counterpart of AsValidationSnippet(), so the UI can validate without a round trip
+// to the server. must produce the same errors (codes and messages) for the same input.
+// x is the command's JSON payload, where absent fields get the same value as in Go (default
+// or zero value).
+func (c *CommandFieldSpec) AsTsValidationSnippet(module *Module) string {
+	goType := c.AsGoType(module)
+
+	snippets := []string{}
+
+	if c.Type == "list" {
+		if !c.Optional && !c.minItemsRequiresNonEmpty() {
+			snippets = append(snippets, tsIfReturn(
+				"value.length === 0",
+				fmt.Sprintf("fieldEmptyValidationError('%s')", c.Key),
+				"\t\t"))
+		}
+
+		if c.MinItems != nil {
+			snippets = append(snippets, tsIfReturn(
+				fmt.Sprintf("value.length < %d", *c.MinItems),
+				fmt.Sprintf("fieldItemCountValidationError('%s', 'at least %d', value.length)", c.Key, *c.MinItems),
+				"\t\t"))
+		}
+
+		if c.MaxItems != nil {
+			snippets = append(snippets, tsIfReturn(
+				fmt.Sprintf("value.length > %d", *c.MaxItems),
+				fmt.Sprintf("fieldItemCountValidationError('%s', 'at most %d', value.length)", c.Key, *c.MaxItems),
+				"\t\t"))
+		}
+
+		// items can't be empty, even if the list can
+		if itemSnippet := c.listItemSpec().tsValueValidationSnippet(module, "item", "\t\t\t"); itemSnippet != "" {
+			snippets = append(snippets, fmt.Sprintf(
+				`for (let idx = 0; idx < value.length; idx++) {
+			const item = value[idx];
+			%s
+		}`,
+				itemSnippet))
+		}
+	} else if goType == "time.Time" {
+		if !c.Optional {
+			snippets = append(snippets, tsIfReturn(
+				"value === ''",
+				fmt.Sprintf("fieldEmptyValidationError('%s')", c.Key),
+				"\t\t"))
+		}
+	} else if goType == "bool" || goType == "guts.Date" {
+		// presence check not possible for these types
+	} else if goType == "string" || goType == "int" {
+		if snippet := c.tsValueValidationSnippet(module, "value", "\t\t"); snippet != "" {
+			snippets = append(snippets, snippet)
+		}
+	} else if isCustomType(goType) {
+		if !c.Optional {
+			compareTo := "null" // struct
+			if enum := module.enumByName(goType); enum != nil {
+				if !enum.IsInteger() {
+					compareTo = "''"
+				} else if !enum.hasMemberWithValue(0) {
+					compareTo = "0"
+				} else { // zero value is a valid member, so can't tell absence from it
+					compareTo = ""
+				}
+			}
+
+			if compareTo != "" {
+				snippets = append(snippets, tsIfReturn(
+					"value === "+compareTo,
+					fmt.Sprintf("fieldEmptyValidationError('%s')", c.Key),
+					"\t\t"))
+			}
+		}
+	} else {
+		panic(errors.New("validation not supported for type: " + goType))
+	}
+
+	if len(snippets) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"{\n\t\tconst value = valueOr(x.%s, %s);\n\t\t%s\n\t}",
+		c.Key,
+		c.tsAbsentValue(module),
+		strings.Join(snippets, "\n\t\t"))
+}
+
+// validations for a string or a number whose value is in expr
+func (c *CommandFieldSpec) tsValueValidationSnippet(module *Module, expr string, indent string) string {
+	snippets := []string{}
+
+	// helpers return null if ok
+	ifHelperFails := func(errName string, helperCall string) string {
+		return fmt.Sprintf("const %s = %s;\n%s", errName, helperCall, indent) + tsIfReturn(errName, errName, indent)
+	}
+
+	switch c.AsGoType(module) {
+	case "int": // presence check not possible
+		if c.Min != nil {
+			snippets = append(snippets, tsIfReturn(
+				fmt.Sprintf("%s < %s", expr, formatNumber(*c.Min)),
+				fmt.Sprintf("fieldRangeValidationError('%s', 'at least %s', %s)", c.Key, formatNumber(*c.Min), expr),
+				indent))
+		}
+
+		if c.Max != nil {
+			snippets = append(snippets, tsIfReturn(
+				fmt.Sprintf("%s > %s", expr, formatNumber(*c.Max)),
+				fmt.Sprintf("fieldRangeValidationError('%s', 'at most %s', %s)", c.Key, formatNumber(*c.Max), expr),
+				indent))
+		}
+
+		if c.hasStepConstraint() {
+			snippets = append(snippets, tsIfReturn(
+				fmt.Sprintf("(%s - %s) %% %s !== 0", expr, formatNumber(c.stepBase()), formatNumber(*c.Step)),
+				fmt.Sprintf("fieldRangeValidationError('%s', '%s', %s)", c.Key, c.stepConstraint(), expr),
+				indent))
+		}
+	case "string":
+		if !c.Optional {
+			snippets = append(snippets, tsIfReturn(
+				expr+" === ''",
+				fmt.Sprintf("fieldEmptyValidationError('%s')", c.Key),
+				indent))
+		}
+
+		if c.MinLength != nil {
+			cond := fmt.Sprintf("byteLength(%s) < %d", expr, *c.MinLength)
+			if c.Optional { // empty is fine
+				cond = fmt.Sprintf("%s !== '' && %s", expr, cond)
+			}
+
+			snippets = append(snippets, tsIfReturn(
+				cond,
+				fmt.Sprintf("fieldMinLengthValidationError('%s', %d, byteLength(%s))", c.Key, *c.MinLength, expr),
+				indent))
+		}
+
+		maxLen := c.maxLength()
+
+		snippets = append(snippets, tsIfReturn(
+			fmt.Sprintf("byteLength(%s) > %d", expr, maxLen),
+			fmt.Sprintf("fieldLengthValidationError('%s', %d, byteLength(%s))", c.Key, maxLen, expr),
+			indent))
+
+		if c.ValidationRegex != "" {
+			snippets = append(snippets, ifHelperFails("patternErr", fmt.Sprintf(
+				"regexpValidation('%s', '%s', %s)",
+				c.Key,
+				escapeStringInsideJsSingleQuotes(c.ValidationRegex),
+				expr)))
+		}
+
+		if pattern, hasFormat := fieldFormatPatterns[c.Type]; hasFormat {
+			snippets = append(snippets, ifHelperFails("formatErr", fmt.Sprintf(
+				"formatValidation('%s', '%s', '%s', %s)",
+				c.Key,
+				c.Type,
+				escapeStringInsideJsSingleQuotes(pattern),
+				expr)))
+		}
+
+		if c.Type == "decimal" && (c.Min != nil || c.Max != nil || c.Step != nil) {
+			optionalNumber := func(num *float64) string {
+				if num == nil {
+					return "''"
+				}
+
+				return "'" + formatNumber(*num) + "'"
+			}
+
+			snippets = append(snippets, ifHelperFails("rangeErr", fmt.Sprintf(
+				"decimalRangeValidation('%s', %s, %s, %s, %s)",
+				c.Key,
+				expr,
+				optionalNumber(c.Min),
+				optionalNumber(c.Max),
+				optionalNumber(c.Step))))
+		}
+
+		if c.Type != "multiline" {
+			snippets = append(snippets, ifHelperFails("newlinesErr", fmt.Sprintf(
+				"noNewlinesValidation('%s', %s)",
+				c.Key,
+				expr)))
+		}
+	}
+
+	return strings.Join(snippets, "\n"+indent)
+}
+
+// TypeScript literal for the value that Go sees if the field is absent from the payload
+func (c *CommandFieldSpec) tsAbsentValue(module *Module) string {
+	if c.Default != nil { // allocator pre-fills it
+		return c.DefaultJson()
+	}
+
+	goType := c.AsGoType(module)
+
+	switch {
+	case c.Type == "list":
+		return "[]"
+	case goType == "int":
+		return "0"
+	case goType == "string" || goType == "time.Time": // JSON representation of zero time doesn't matter
+		return "''"
+	case isCustomType(goType):
+		if enum := module.enumByName(goType); enum != nil {
+			if enum.IsInteger() {
+				return "0"
+			}
+
+			return "''"
+		}
+
+		return "null"
+	default:
+		return "undefined"
+	}
+}
+
+// returns TypeScript code (as a string) for validating command inputs
+func (c *CommandSpec) MakeTsValidation(module *Module) string {
+	validationSnippets := []string{}
+
+	for _, field := range c.Fields {
+		validationSnippet := field.AsTsValidationSnippet(module)
+		if validationSnippet == "" {
+			continue
+		}
+
+		validationSnippets = append(validationSnippets, validationSnippet)
+	}
+
+	return strings.Join(validationSnippets, "\n\t")
+}
+
+// formats "if (<cond>) {\n\treturn <returnExpr>;\n}" with our indentation
+func tsIfReturn(cond string, returnExpr string, indent string) string {
+	return fmt.Sprintf("if (%s) {\n%s\treturn %s;\n%s}", cond, indent, returnExpr, indent)
+}
@@ -1,21 +1,41 @@
 package codegen
 
-type ProcessedStringEnumMember struct {
-	Key     string
-	GoKey   string
-	GoValue string
+type ProcessedEnumMember struct {
+	SpecKey     string // "dark_blue" (as in spec)
+	Key         string // "DarkBlue"
+	GoKey       string // "ColorDarkBlue"
+	GoValue     string // "dark_blue" | "2" (for integer enums)
+	Label       string
+	Description string
+	Deprecated  Deprecation
 }
 
-type ProcessedStringEnum struct {
+type ProcessedEnum struct {
 	Name          string
+	Integer       bool // integer-backed instead of string-backed
 	MembersDigest string
-	Members       []ProcessedStringEnumMember
+	Members       []ProcessedEnumMember
 }
 
+// Deprecated: use ProcessedEnumMember
+type ProcessedStringEnumMember = ProcessedEnumMember
+
+// Deprecated: use ProcessedEnum
+type ProcessedStringEnum = ProcessedEnum
+
 type EnumDef struct {
-	Name          string   `json:"name"`
-	Type          string   `json:"type"`
-	StringMembers []string `json:"stringMembers"`
+	Name          string          `json:"name"`
+	Type          string          `json:"type"`          // "string" | "integer"
+	StringMembers []string        `json:"stringMembers"` // shorthand for string members without metadata
+	Members       []EnumMemberDef `json:"members"`
+}
+
+type EnumMemberDef struct {
+	Key         string      `json:"key"`   // required for integer enums, defaults to value for string enums
+	Value       interface{} `json:"value"` // string | integer
+	Label       string      `json:"label"` // for UI. defaults to key
+	Description string      `json:"description"`
+	Deprecated  Deprecation `json:"deprecated"`
 }
 
 type StringConstDef struct {
@@ -32,6 +52,7 @@ type EventDefForTpl struct {
 	CtorArgs        string
 	CtorAssignments string
 	GoStructName    string
+	Deprecated      Deprecation
 }
 
 type Imports struct {
@@ -58,16 +79,18 @@ type TplData struct {
 	CommandsImports        Imports
 	CommandsImportsUi      Imports // UI only needs types that are mentioned in ctor
 	EventsImports          Imports
-	StringEnums            []ProcessedStringEnum
+	Enums                  []ProcessedEnum
+	StringEnums            []ProcessedStringEnum // Deprecated: use Enums (this has only the string-backed ones)
 	EventStructsAsGoCode   string
 	EventDefs              []EventDefForTpl
 }
 
 type EventSpec struct {
-	Event     string            `json:"event"`
-	CtorArgs  []string          `json:"ctor"`
-	Changelog []string          `json:"changelog"`
-	Fields    []*EventFieldSpec `json:"fields"`
+	Event      string            `json:"event"`
+	CtorArgs   []string          `json:"ctor"`
+	Changelog  []string          `json:"changelog"`
+	Fields     []*EventFieldSpec `json:"fields"`
+	Deprecated Deprecation       `json:"deprecated"`
 }
 
 type EventFieldSpec struct {
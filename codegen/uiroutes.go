@@ -1,6 +1,8 @@
 package codegen
 
 import (
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -52,6 +54,90 @@ func (u *uiRouteSpec) TsPath() string {
 	})
 }
 
+// "person" => "Person"
+func (u *uiRouteSpec) GoName() string {
+	return strings.Title(u.Id)
+}
+
+func (u *uiRouteSpec) GoOptsName() string {
+	return u.GoName() + "Opts"
+}
+
+// path placeholder or query param, as a field of the route's Go opts struct
+type uiRouteGoParam struct {
+	Key      string // "id"
+	GoField  string // "Id"
+	GoType   string // "string" | "*string" | "int" | "*int"
+	Integer  bool
+	Nullable bool
+}
+
+func (u *uiRouteSpec) GoPathParams() []uiRouteGoParam {
+	params := []uiRouteGoParam{}
+	for _, placeholder := range u.PathPlaceholders() {
+		params = append(params, uiRouteGoParam{
+			Key:     placeholder,
+			GoField: strings.Title(placeholder),
+			GoType:  "string",
+		})
+	}
+
+	return params
+}
+
+func (u *uiRouteSpec) GoQueryParams() []uiRouteGoParam {
+	params := []uiRouteGoParam{}
+	for _, queryParam := range u.QueryParams {
+		param := uiRouteGoParam{
+			Key:      queryParam.Key,
+			GoField:  strings.Title(queryParam.Key),
+			GoType:   "string",
+			Integer:  queryParam.Type.NameRaw == "integer",
+			Nullable: queryParam.Type.Nullable,
+		}
+
+		if param.Integer {
+			param.GoType = "int"
+		}
+
+		if param.Nullable {
+			param.GoType = "*" + param.GoType
+		}
+
+		params = append(params, param)
+	}
+
+	return params
+}
+
+// "/persons/{id}" => "/persons/"+url.PathEscape(opts.Id)
+func (u *uiRouteSpec) GoPath() string {
+	placeholders := u.GoPathParams()
+
+	exprs := []string{}
+	for idx, literal := range routePlaceholderParseRe.Split(u.Path, -1) {
+		if literal != "" {
+			exprs = append(exprs, strconv.Quote(literal))
+		}
+
+		if idx < len(placeholders) {
+			exprs = append(exprs, "url.PathEscape(opts."+placeholders[idx].GoField+")")
+		}
+	}
+
+	return strings.Join(exprs, "+")
+}
+
+// "/persons/{id}" => "^/persons/([^/]+)$" as a Go string literal
+func (u *uiRouteSpec) PathReGo() string {
+	literalParts := routePlaceholderParseRe.Split(u.Path, -1)
+	for idx := range literalParts {
+		literalParts[idx] = regexp.QuoteMeta(literalParts[idx])
+	}
+
+	return strconv.Quote("^" + strings.Join(literalParts, "([^/]+)") + "$")
+}
+
 func removeBraces(input string) string {
 	return strings.Trim(input, "{}")
 }
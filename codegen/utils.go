@@ -1,6 +1,7 @@
 package codegen
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/url"
@@ -11,25 +12,37 @@ import (
 )
 
 func WriteTemplateFile(filename string, data interface{}, templateString string) error {
+	rendered, err := renderTemplate(filename, data, templateString)
+	if err != nil {
+		return err
+	}
+
+	return osutil.WriteFileAtomic(filename, func(file io.Writer) error {
+		_, err := file.Write(rendered)
+		return err
+	})
+}
+
+func renderTemplate(filename string, data interface{}, templateString string) ([]byte, error) {
 	templateFuncs := template.FuncMap{
 		"add":                    func(a, b int) int { return a + b },
 		"StripQueryFromUrl":      stripQueryFromUrl,
 		"UppercaseFirst":         func(input string) string { return strings.ToUpper(input[0:1]) + input[1:] },
 		"EscapeForJsSingleQuote": func(input string) string { return strings.ReplaceAll(input, `'`, `\'`) },
+		"GoComment":              goComment,
 	}
 
 	tpl, err := template.New("").Funcs(templateFuncs).Parse(templateString)
 	if err != nil {
-		return fmt.Errorf("WriteTemplateFile Parse %s: %v", filename, err)
+		return nil, fmt.Errorf("WriteTemplateFile Parse %s: %v", filename, err)
 	}
 
-	return osutil.WriteFileAtomic(filename, func(file io.Writer) error {
-		if err := tpl.Execute(file, data); err != nil {
-			return fmt.Errorf("WriteTemplateFile %s: %w", filename, err)
-		}
+	rendered := &bytes.Buffer{}
+	if err := tpl.Execute(rendered, data); err != nil {
+		return nil, fmt.Errorf("WriteTemplateFile %s: %w", filename, err)
+	}
 
-		return nil
-	})
+	return rendered.Bytes(), nil
 }
 
 // "/search?q={stuff}" => "/search"
@@ -42,6 +55,16 @@ func stripQueryFromUrl(input string) string {
 	return u.Path
 }
 
+// ("\t", "Red.\nLike blood.") => "\t// Red.\n\t// Like blood.", so multi-line text stays a comment
+func goComment(indent string, text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for idx, line := range lines {
+		lines[idx] = strings.TrimRight(indent+"// "+line, " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 func allOk(errs ...error) error {
 	for _, err := range errs {
 		if err != nil {
@@ -0,0 +1,551 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/function61/gokit/sliceutil"
+)
+
+// a mistake in a spec file, pinpointed to the offending element
+type SpecError struct {
+	File    string // "pkg/foo/commands.json"
+	Line    int    // 0 if not known
+	Col     int
+	Element string // `command "user.Create" field "Name"`. can be empty
+	Problem string
+}
+
+// "pkg/foo/commands.json:12:5: command "user.Create": defined more than once"
+func (s SpecError) Error() string {
+	location := s.File
+	if s.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Col)
+	}
+
+	if s.Element == "" {
+		return location + ": " + s.Problem
+	}
+
+	return location + ": " + s.Element + ": " + s.Problem
+}
+
+// all mistakes found in a module's spec files
+type SpecErrors []SpecError
+
+// one problem per line
+func (s SpecErrors) Error() string {
+	lines := []string{}
+
+	for _, specErr := range s {
+		lines = append(lines, specErr.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+type specValidator struct {
+	module *Module
+	errs   SpecErrors
+}
+
+// something in a spec file that we can complain about
+type specElement struct {
+	file    string
+	pointer string // JSON pointer inside the file, like "/3/fields/2"
+	name    string // `command "user.Create" field "Name"`
+}
+
+func (s specElement) child(pointerSuffix string, nameSuffix string) specElement {
+	return specElement{
+		file:    s.file,
+		pointer: s.pointer + pointerSuffix,
+		name:    s.name + nameSuffix,
+	}
+}
+
+func (v *specValidator) add(el specElement, format string, args ...interface{}) {
+	line, col, _ := v.module.specPositions[el.file].lookup(el.pointer)
+
+	v.errs = append(v.errs, SpecError{
+		File:    el.file,
+		Line:    line,
+		Col:     col,
+		Element: el.name,
+		Problem: fmt.Sprintf(format, args...),
+	})
+}
+
+// checks the module's spec files for mistakes that would otherwise surface as panics from
+// inside templates, or as broken generated code. returns SpecErrors with all problems found.
+// also fills in defaults (command field type defaults to "text").
+func (m *Module) Validate() error {
+	v := &specValidator{module: m}
+
+	v.validateTypes()
+	v.validateEvents()
+	v.validateCommands()
+	v.validateUiRoutes()
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+
+	return nil
+}
+
+func (v *specValidator) validateTypes() {
+	file := v.module.TypesFile
+	types := v.module.Types
+
+	seenTypeNames := map[string]bool{}
+	checkTypeName := func(name string, el specElement) {
+		if name == "" {
+			v.add(el, "name empty")
+		} else if !isCustomType(name) {
+			v.add(el, "name must begin with an uppercase letter")
+		} else if seenTypeNames[name] {
+			v.add(el, "defined more than once")
+		}
+
+		seenTypeNames[name] = true
+	}
+
+	for idx, enum := range types.Enums {
+		el := specElement{file, fmt.Sprintf("/enums/%d", idx), fmt.Sprintf("enum %q", enum.Name)}
+
+		checkTypeName(enum.Name, el)
+
+		switch enum.Type {
+		case "string":
+		case "integer":
+			if len(enum.StringMembers) > 0 {
+				v.add(el.child("/stringMembers", ""), "stringMembers only applies to string enums")
+			}
+		default:
+			v.add(el.child("/type", ""), "unsupported enum type %q (supported: string, integer)", enum.Type)
+			continue
+		}
+
+		if len(enum.StringMembers) == 0 && len(enum.Members) == 0 {
+			v.add(el, "no members")
+		}
+
+		// stringMembers shorthand and members can be mixed, so keys and values must be unique across both
+		seenKeys := map[string]bool{}
+		seenValues := map[string]bool{}
+		checkUnique := func(memberEl specElement, key string, value string) {
+			if seenValues[value] {
+				v.add(memberEl, "value %s defined more than once", value)
+			} else if seenKeys[camelCaseEnumValue(key)] {
+				v.add(memberEl, "key %q defined more than once", key)
+			}
+
+			seenKeys[camelCaseEnumValue(key)] = true
+			seenValues[value] = true
+		}
+
+		for memberIdx, member := range enum.Members {
+			memberEl := el.child(fmt.Sprintf("/members/%d", memberIdx), fmt.Sprintf(" member %q", member.key()))
+
+			switch value := member.Value.(type) {
+			case string:
+				if enum.IsInteger() {
+					v.add(memberEl.child("/value", ""), "value must be an integer")
+					continue
+				}
+
+				if value == "" {
+					v.add(memberEl.child("/value", ""), "value empty")
+					continue
+				}
+			case float64:
+				if !enum.IsInteger() {
+					v.add(memberEl.child("/value", ""), "value must be a string")
+					continue
+				}
+
+				if value != float64(int64(value)) {
+					v.add(memberEl.child("/value", ""), "value must be a whole number")
+					continue
+				}
+
+				if member.Key == "" {
+					v.add(memberEl, "key is required for members of integer enums")
+					continue
+				}
+			default:
+				v.add(memberEl, "value missing")
+				continue
+			}
+
+			if member.Key != "" && camelCaseEnumValue(member.Key) == "" {
+				v.add(memberEl.child("/key", ""), "key %q has no letters or digits", member.Key)
+			}
+
+			checkUnique(memberEl, member.key(), fmt.Sprintf("%q", member.valueAsString()))
+		}
+
+		for memberIdx, member := range enum.StringMembers {
+			checkUnique(
+				el.child(fmt.Sprintf("/stringMembers/%d", memberIdx), ""),
+				member,
+				fmt.Sprintf("%q", member))
+		}
+	}
+
+	for idx, namedType := range types.Types {
+		el := specElement{file, fmt.Sprintf("/types/%d", idx), fmt.Sprintf("type %q", namedType.Name)}
+
+		checkTypeName(namedType.Name, el)
+
+		v.validateDatatype(el.child("/type", ""), namedType.Type)
+	}
+
+	seenConsts := map[string]bool{}
+	for idx, stringConst := range types.StringConsts {
+		el := specElement{file, fmt.Sprintf("/stringConsts/%d", idx), fmt.Sprintf("stringConst %q", stringConst.Key)}
+
+		if stringConst.Key == "" {
+			v.add(el, "key empty")
+		} else if seenConsts[stringConst.Key] {
+			v.add(el, "defined more than once")
+		}
+		seenConsts[stringConst.Key] = true
+	}
+
+	seenEndpoints := map[string]bool{}
+	for idx, endpoint := range types.Endpoints {
+		el := specElement{file, fmt.Sprintf("/endpoints/%d", idx), fmt.Sprintf("endpoint %q", endpoint.Name)}
+		if endpoint.Name == "" {
+			el.name = fmt.Sprintf("endpoint with path %q", endpoint.Path)
+		}
+
+		if endpoint.Name == "" {
+			v.add(el, "name empty")
+		} else if seenEndpoints[endpoint.Name] {
+			v.add(el, "defined more than once")
+		}
+		seenEndpoints[endpoint.Name] = true
+
+		if endpoint.Path == "" {
+			v.add(el, "path empty")
+		}
+
+		for _, placeholder := range routePlaceholderParseRe.FindAllStringSubmatch(endpoint.Path, -1) {
+			if endpointClientReservedNames[placeholder[1]] {
+				v.add(el, "path placeholder %q collides with generated client's identifier", placeholder[1])
+			}
+		}
+
+		if endpoint.HttpMethod == "" {
+			v.add(el, "method empty")
+		}
+
+		if endpoint.MiddlewareChain == "" {
+			v.add(el, "chain empty")
+		}
+
+		if endpoint.Produces != nil {
+			v.validateDatatype(el.child("/produces", " produces"), endpoint.Produces)
+		}
+
+		if endpoint.Consumes != nil {
+			v.validateDatatype(el.child("/consumes", " consumes"), endpoint.Consumes)
+		}
+	}
+}
+
+func (v *specValidator) validateEvents() {
+	file := v.module.EventsSpecFile
+
+	seenEvents := map[string]bool{}
+
+	for idx, event := range v.module.Events.Events {
+		el := specElement{file, fmt.Sprintf("/events/%d", idx), fmt.Sprintf("event %q", event.Event)}
+
+		if event.Event == "" {
+			v.add(el, "name empty")
+		} else if seenEvents[event.Event] {
+			v.add(el, "defined more than once")
+		}
+		seenEvents[event.Event] = true
+
+		seenFields := map[string]bool{}
+		for fieldIdx, field := range event.Fields {
+			fieldEl := el.child(fmt.Sprintf("/fields/%d", fieldIdx), fmt.Sprintf(" field %q", field.Key))
+
+			if field.Key == "" {
+				v.add(fieldEl, "key empty")
+			} else if seenFields[field.Key] {
+				v.add(fieldEl, "defined more than once")
+			}
+			seenFields[field.Key] = true
+
+			v.validateDatatype(fieldEl.child("/type", ""), &field.Type)
+		}
+
+		for ctorIdx, ctorArg := range event.CtorArgs {
+			if !seenFields[ctorArg] {
+				v.add(el.child(fmt.Sprintf("/ctor/%d", ctorIdx), ""), "ctor arg %q has no matching field", ctorArg)
+			}
+		}
+	}
+}
+
+func (v *specValidator) validateCommands() {
+	file := v.module.CommandsSpecFile
+
+	seenCommands := map[string]bool{}
+
+	for idx, cmd := range *v.module.Commands {
+		el := specElement{file, fmt.Sprintf("/%d", idx), fmt.Sprintf("command %q", cmd.Command)}
+
+		if cmd.Command == "" {
+			v.add(el, "name empty")
+		} else if seenCommands[cmd.Command] {
+			v.add(el, "defined more than once")
+		}
+		seenCommands[cmd.Command] = true
+
+		if cmd.MiddlewareChain == "" {
+			v.add(el, "chain empty")
+		}
+
+		seenFields := map[string]bool{}
+		for fieldIdx, field := range cmd.Fields {
+			fieldEl := el.child(fmt.Sprintf("/fields/%d", fieldIdx), fmt.Sprintf(" field %q", field.Key))
+
+			if field.Key == "" {
+				v.add(fieldEl, "key empty")
+			} else if seenFields[field.Key] {
+				v.add(fieldEl, "defined more than once")
+			}
+			seenFields[field.Key] = true
+
+			v.validateCommandField(fieldEl, field)
+		}
+
+		for ctorIdx, ctorArg := range cmd.CtorArgs {
+			if !seenFields[ctorArg] {
+				v.add(el.child(fmt.Sprintf("/ctor/%d", ctorIdx), ""), "ctor arg %q has no matching field", ctorArg)
+			}
+		}
+	}
+}
+
+func (v *specValidator) validateCommandField(el specElement, field *CommandFieldSpec) {
+	if field.Type == "" {
+		field.Type = "text"
+	}
+
+	if isCustomType(field.Type) {
+		if !v.module.typeDefined(field.Type) {
+			v.add(el.child("/type", ""), "undefined type %q", field.Type)
+			return
+		}
+	} else if field.Type == "list" && !sliceutil.ContainsString(listItemTypes, field.ListOf) {
+		v.add(el.child("/of", ""), "unsupported list item type %q (supported: %s)", field.ListOf, strings.Join(listItemTypes, ", "))
+		return
+	} else if field.AsGoType(v.module) == "" || field.AsTsType() == "" {
+		v.add(el.child("/type", ""), "invalid type %q", field.Type)
+		return
+	}
+
+	if field.ListOf != "" && field.Type != "list" {
+		v.add(el.child("/of", ""), `"of" only applies to lists`)
+	}
+
+	if field.ValidationRegex != "" {
+		if _, err := regexp.Compile(field.ValidationRegex); err != nil {
+			v.add(el.child("/validation_regex", ""), "invalid validation_regex: %v", err)
+		}
+	}
+
+	if field.MaxLength != nil && *field.MaxLength <= 0 {
+		v.add(el.child("/max_length", ""), "max_length must be positive")
+	}
+
+	if _, err := field.goDefaultLiteral(v.module); err != nil {
+		v.add(el.child("/default", ""), "%v", err)
+	}
+
+	v.validateCommandFieldConstraints(el, field)
+}
+
+// min, max, step, min_length, min_items, max_items
+func (v *specValidator) validateCommandFieldConstraints(el specElement, field *CommandFieldSpec) {
+	// for lists, these apply to the items
+	valueSpec := field
+	if field.Type == "list" {
+		valueSpec = field.listItemSpec()
+	}
+
+	isString := valueSpec.AsGoType(v.module) == "string"
+
+	if field.Min != nil || field.Max != nil || field.Step != nil {
+		switch valueSpec.Type {
+		case "integer", "custom/integer":
+			mustBeWhole := func(attr string, num *float64) {
+				if num != nil && *num != float64(int64(*num)) {
+					v.add(el.child("/"+attr, ""), "%s must be a whole number for integers", attr)
+				}
+			}
+
+			mustBeWhole("min", field.Min)
+			mustBeWhole("max", field.Max)
+			mustBeWhole("step", field.Step)
+		case "decimal":
+		default:
+			v.add(el, "min, max and step only apply to integer and decimal fields")
+		}
+
+		if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+			v.add(el.child("/min", ""), "min greater than max")
+		}
+
+		if field.Step != nil && *field.Step <= 0 {
+			v.add(el.child("/step", ""), "step must be positive")
+		}
+	}
+
+	if field.MinLength != nil {
+		if !isString {
+			v.add(el.child("/min_length", ""), "min_length only applies to text fields")
+		} else if *field.MinLength < 0 || *field.MinLength > field.maxLength() {
+			v.add(el.child("/min_length", ""), "min_length must be between 0 and max length (%d)", field.maxLength())
+		}
+	}
+
+	if field.MinItems != nil || field.MaxItems != nil {
+		if field.Type != "list" {
+			v.add(el, "min_items and max_items only apply to lists")
+		}
+
+		if field.MinItems != nil && *field.MinItems < 0 {
+			v.add(el.child("/min_items", ""), "min_items must not be negative")
+		}
+
+		if field.MinItems != nil && field.MaxItems != nil && *field.MinItems > *field.MaxItems {
+			v.add(el.child("/min_items", ""), "min_items greater than max_items")
+		}
+	}
+}
+
+// keys are used as-is as Go and TypeScript identifiers
+var uiRouteParamKeyRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (v *specValidator) validateUiRoutes() {
+	file := v.module.UiRoutesFile
+
+	seenIds := map[string]bool{}
+
+	for idx, route := range v.module.UiRoutes {
+		el := specElement{file, fmt.Sprintf("/%d", idx), fmt.Sprintf("route %q", route.Id)}
+
+		if route.Id == "" {
+			v.add(el, "id empty")
+		} else if seenIds[route.Id] {
+			v.add(el, "defined more than once")
+		}
+		seenIds[route.Id] = true
+
+		if route.Path == "" {
+			v.add(el, "path empty")
+		}
+
+		// path placeholders and query params share the opts struct, so their Go fields must be unique
+		paramByGoField := map[string]string{}
+		for _, placeholder := range route.PathPlaceholders() {
+			if !uiRouteParamKeyRe.MatchString(placeholder) {
+				v.add(el.child("/path", ""), "path placeholder %q is not a valid identifier", placeholder)
+			}
+
+			if other, clash := paramByGoField[strings.Title(placeholder)]; clash {
+				v.add(el, "path placeholder %q clashes with %s", placeholder, other)
+			}
+			paramByGoField[strings.Title(placeholder)] = fmt.Sprintf("path placeholder %q", placeholder)
+		}
+
+		for paramIdx, queryParam := range route.QueryParams {
+			paramEl := el.child(fmt.Sprintf("/query_params/%d", paramIdx), fmt.Sprintf(" query param %q", queryParam.Key))
+
+			if queryParam.Key == "" {
+				v.add(paramEl, "key empty")
+			} else if !uiRouteParamKeyRe.MatchString(queryParam.Key) {
+				v.add(paramEl.child("/key", ""), "key is not a valid identifier (letters, digits and underscores, not starting with a digit)")
+			} else if other, clash := paramByGoField[strings.Title(queryParam.Key)]; clash {
+				v.add(paramEl, "clashes with %s", other)
+			}
+			paramByGoField[strings.Title(queryParam.Key)] = fmt.Sprintf("query param %q", queryParam.Key)
+
+			switch queryParam.Type.NameRaw {
+			case "string", "integer":
+			default:
+				v.add(
+					el.child(fmt.Sprintf("/query_params/%d/type", paramIdx), fmt.Sprintf(" query param %q", queryParam.Key)),
+					"unsupported type %q (supported: string, integer)",
+					queryParam.Type.NameRaw)
+			}
+		}
+	}
+}
+
+// recurses into lists and objects
+func (v *specValidator) validateDatatype(el specElement, dt *DatatypeDef) {
+	if dt == nil || dt.NameRaw == "" {
+		v.add(el, "type missing")
+		return
+	}
+
+	if dt.isCustomType() {
+		if !v.module.typeDefined(dt.NameRaw) {
+			v.add(el, "undefined type %q", dt.NameRaw)
+		}
+		return
+	}
+
+	switch dt.Name() {
+	case "integer", "binary", "string", "boolean", "datetime", "date":
+	case "list":
+		if dt.Of == nil {
+			v.add(el, `list without "of"`)
+			return
+		}
+
+		v.validateDatatype(el.child("/of", " list item"), dt.Of)
+	case "object":
+		for _, field := range dt.FieldsSorted() {
+			v.validateDatatype(el.child("/fields/"+escapeJsonPointerToken(field.Key), fmt.Sprintf(" field %q", field.Key)), field.Type)
+		}
+	default:
+		v.add(el, "unsupported type %q", dt.NameRaw)
+	}
+}
+
+// name is "Type" | "module.Type"
+func (m *Module) hasNamedType(name string) bool {
+	mod, typeName := m.resolveTypeRef(name)
+	if mod == nil {
+		return false
+	}
+
+	for _, namedType := range mod.Types.Types {
+		if namedType.Name == typeName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ref is "Type" | "module.Type". types of modules not part of this codegen run can't be checked,
+// so they're assumed to exist
+func (m *Module) typeDefined(ref string) bool {
+	if mod, _ := m.resolveTypeRef(ref); mod == nil {
+		return true
+	}
+
+	return m.HasEnum(ref) || m.hasNamedType(ref)
+}
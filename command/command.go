@@ -19,6 +19,23 @@ type Invoker interface {
 	Invoke(cmdGeneric Command, ctx *Ctx) error
 }
 
+// implemented by commands that the spec marks deprecated
+type Deprecated interface {
+	Deprecation() string // "Use user.Register instead."
+}
+
+// returned by generated Validate() for invalid field values. Code is stable (the generated
+// TypeScript validators produce the same codes), Message is for humans.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"` // "field_empty" | "field_too_long" | "field_out_of_range" | ...
+	Message string `json:"message"`
+}
+
+func (v *ValidationError) Error() string {
+	return v.Message
+}
+
 // map keyed by command name (command.Key()) values are functions that allocates a new
 // specific command struct
 type Allocators map[string]func() Command
@@ -79,3 +96,11 @@ func (c *Ctx) GetCreatedRecordId() string {
 func (c *Ctx) Cookies() []*http.Cookie {
 	return c.cookies
 }
+
+// forgets everything the handler produced (raised events, cookies, created record ID), so
+// that the same context can be used for re-running the handler without double-appending
+func (c *Ctx) Reset() {
+	c.raisedEvents = []ehevent.Event{}
+	c.cookies = []*http.Cookie{}
+	c.createdRecordId = ""
+}
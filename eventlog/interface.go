@@ -1,9 +1,15 @@
 package eventlog
 
 import (
+	"errors"
+
 	"github.com/function61/eventhorizon/pkg/ehevent"
 )
 
+// Append() returns this (possibly wrapped) when the events could not be appended because
+// someone else appended to the stream after we read it (optimistic concurrency control)
+var ErrConcurrencyConflict = errors.New("eventlog: concurrency conflict")
+
 // DEPRECATED: will soon be removed
 type Log interface {
 	Append(events []ehevent.Event) error
@@ -1,9 +1,24 @@
 // Generic command dispatcher boilerplate. Takes in POST /api/command/... request and
 // dispatches it to the command handler, and submits possible events to an event log.
+//
+// Errors returned by command handlers are mapped to responses like this:
+//
+//	ClientError(err)              400 "command_failed", with err's message
+//	*command.ValidationError      400 "command_validation_failed"
+//	*HttpError                    as-is
+//	anything else                 500 "internal_error", message hidden and reported with ReportInternalErrorsTo()
+//
+// Migrating: unmarked errors used to be 400 "command_failed" with the message shown to the
+// client. Handlers that return errors meant for the user (like errors.New("name already taken"))
+// must now wrap them with ClientError(), otherwise the user sees a generic internal error.
 package httpcommand
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
 	"net/http"
 	"time"
 
@@ -15,6 +30,7 @@ import (
 
 const (
 	CreatedRecordIdHeaderKey = "x-created-record-id"
+	DeprecationHeaderKey     = "Deprecation" // set if the invoked command is deprecated
 )
 
 var noResponse = NewHttpError(0, "", "")
@@ -24,10 +40,11 @@ type HttpError struct {
 	StatusCode  int // if 0, means errored but error response already sent by middleware
 	ErrorCode   string
 	Description string
+	Validation  *command.ValidationError // details if ErrorCode is "command_validation_failed"
 }
 
 func NewHttpError(statusCode int, errorCode string, description string) *HttpError {
-	return &HttpError{statusCode, errorCode, description}
+	return &HttpError{StatusCode: statusCode, ErrorCode: errorCode, Description: description}
 }
 
 func (r *HttpError) Error() string {
@@ -42,6 +59,16 @@ func (r *HttpError) ErrorResponseAlreadySentByMiddleware() bool {
 	return r.StatusCode == 0
 }
 
+// caused by the client (4xx), i.e. retrying the same request won't help
+func (r *HttpError) IsClientError() bool {
+	return r.StatusCode >= 400 && r.StatusCode < 500
+}
+
+// server-side fault (5xx)
+func (r *HttpError) IsServerError() bool {
+	return r.StatusCode >= 500
+}
+
 func badRequest(errorCode string, description string) *HttpError {
 	return NewHttpError(http.StatusBadRequest, errorCode, description)
 }
@@ -54,13 +81,36 @@ func Serve(
 	allocators command.Allocators,
 	invoker command.Invoker,
 	eventLog eventlog.Log,
-) *HttpError {
+	opts ...Option,
+) (herr *HttpError) {
+	conf := newConfig(opts)
+
+	// unsupported commands are observed without labels, as the name comes from the client
+	labels := commandLabels{}
+	replayed := false
+
+	if conf.metrics != nil {
+		started := time.Now()
+
+		// registered before recoverPanic() so this observes the final outcome
+		defer func() {
+			conf.metrics.observeInvocation(labels, invocationOutcome(herr, replayed), time.Since(started))
+		}()
+	}
+
+	defer conf.recoverPanic(&herr)
+
 	allocator, commandExists := allocators[commandName]
 	if !commandExists {
 		return badRequest("unsupported_command", "")
 	}
 
 	cmdStruct := allocator()
+	labels = commandLabels{cmdStruct.Key(), cmdStruct.MiddlewareChain()}
+
+	if _, deprecated := cmdStruct.(command.Deprecated); deprecated {
+		w.Header().Set(DeprecationHeaderKey, "true")
+	}
 
 	middlewareChain := mwares[cmdStruct.MiddlewareChain()]
 	reqCtx := middlewareChain(w, r)
@@ -83,27 +133,70 @@ func Serve(
 		return badRequest("json_parsing_failed", errJson.Error())
 	}
 
+	// scoped to user and command so keys can't be used for replaying others' results. anonymous
+	// requests aren't deduplicated, as anyone knowing the key could replay their session cookies.
+	idempotencyKey := ""
+	resultStored := false
+	if key := r.Header.Get(IdempotencyKeyHeaderKey); key != "" && conf.idempotencyStore != nil && userId != "" {
+		idempotencyKey = userId + "/" + commandName + "/" + key
+
+		result, err := conf.idempotencyStore.Get(idempotencyKey)
+		switch {
+		case errors.Is(err, ErrIdempotencyKeyInFlight):
+			w.Header().Set("Retry-After", "1")
+			return NewHttpError(http.StatusConflict, "idempotency_key_in_flight", err.Error())
+		case err != nil:
+			return conf.internalError(fmt.Errorf("idempotency store: %w", err), nil)
+		case result != nil:
+			replayed = true
+			writeResult(w, *result)
+			return nil
+		}
+
+		// key is now reserved for us. if we don't succeed (incl. panics), the client must be
+		// able to retry
+		defer func() {
+			if !resultStored {
+				conf.idempotencyStore.Release(idempotencyKey)
+			}
+		}()
+	}
+
 	ctx := command.NewCtx(
 		r.Context(),
 		ehevent.Meta(time.Now(), userId),
 		r.RemoteAddr,
 		r.Header.Get("User-Agent"))
 
-	if herr := InvokeSkippingAuthorization(cmdStruct, ctx, invoker, eventLog); herr != nil {
+	if herr := invokeSkippingAuthorization(cmdStruct, ctx, invoker, eventLog, conf); herr != nil {
 		return herr
 	}
 
-	for _, cookie := range ctx.Cookies() {
-		http.SetCookie(w, cookie)
+	result := IdempotentResult{
+		CreatedRecordId: ctx.GetCreatedRecordId(),
+		Cookies:         ctx.Cookies(),
 	}
 
-	if id := ctx.GetCreatedRecordId(); id != "" {
-		w.Header().Set(CreatedRecordIdHeaderKey, id)
+	if idempotencyKey != "" {
+		conf.idempotencyStore.Put(idempotencyKey, result)
+		resultStored = true
 	}
 
+	writeResult(w, result)
+
 	return nil
 }
 
+func writeResult(w http.ResponseWriter, result IdempotentResult) {
+	for _, cookie := range result.Cookies {
+		http.SetCookie(w, cookie)
+	}
+
+	if result.CreatedRecordId != "" {
+		w.Header().Set(CreatedRecordIdHeaderKey, result.CreatedRecordId)
+	}
+}
+
 // validates command, invokes it and pushes raised events to event log
 //
 // "SkippingAuthorization" suffix to warn that no authorization checks are performed
@@ -113,23 +206,109 @@ func InvokeSkippingAuthorization(
 	ctx *command.Ctx,
 	invoker command.Invoker,
 	eventLog eventlog.Log,
-) *HttpError {
+	opts ...Option,
+) (herr *HttpError) {
+	conf := newConfig(opts)
+
+	if conf.metrics != nil {
+		labels := commandLabels{cmdStruct.Key(), cmdStruct.MiddlewareChain()}
+		started := time.Now()
+
+		defer func() {
+			conf.metrics.observeInvocation(labels, invocationOutcome(herr, false), time.Since(started))
+		}()
+	}
+
+	return invokeSkippingAuthorization(cmdStruct, ctx, invoker, eventLog, conf)
+}
+
+// InvokeSkippingAuthorization() without observing metrics, so Serve() can observe the
+// invocation as a whole
+func invokeSkippingAuthorization(
+	cmdStruct command.Command,
+	ctx *command.Ctx,
+	invoker command.Invoker,
+	eventLog eventlog.Log,
+	conf *config,
+) (herr *HttpError) {
+	// validation and handlers are user code which might panic
+	defer conf.recoverPanic(&herr)
+
 	if errValidate := cmdStruct.Validate(); errValidate != nil {
-		return badRequest("command_validation_failed", errValidate.Error())
+		herr := badRequest("command_validation_failed", errValidate.Error())
+
+		var validationErr *command.ValidationError
+		if errors.As(errValidate, &validationErr) {
+			herr.Validation = validationErr
+		}
+
+		return herr
 	}
 
-	if errInvoke := invoker.Invoke(cmdStruct, ctx); errInvoke != nil {
-		// see if returned error is already an *HttpError
-		if httpErr, is := errInvoke.(*HttpError); is {
-			return httpErr // use as-is
-		} else {
-			return badRequest("command_failed", errInvoke.Error())
+	for attempt := 0; ; attempt++ {
+		herr := invokeAndAppend(cmdStruct, ctx, invoker, eventLog, conf)
+		if herr == nil || herr.ErrorCode != "event_append_conflict" || attempt >= conf.conflictRetries {
+			return herr
+		}
+
+		if err := waitBeforeConflictRetry(ctx.Ctx, conf.conflictBackoff, attempt); err != nil {
+			return herr
 		}
+
+		if conf.refreshReadModel != nil {
+			if err := conf.refreshReadModel(ctx.Ctx); err != nil {
+				return conf.internalError(fmt.Errorf("read model refresh: %w", err), nil)
+			}
+		}
+
+		// otherwise events raised by the previous attempt would get appended again
+		ctx.Reset()
+	}
+}
+
+func invokeAndAppend(
+	cmdStruct command.Command,
+	ctx *command.Ctx,
+	invoker command.Invoker,
+	eventLog eventlog.Log,
+	conf *config,
+) *HttpError {
+	if errInvoke := invoker.Invoke(cmdStruct, ctx); errInvoke != nil {
+		return conf.handlerError(errInvoke)
 	}
 
-	if err := eventLog.Append(ctx.GetRaisedEvents()); err != nil {
-		return NewHttpError(http.StatusInternalServerError, "event_append_failed", err.Error())
+	appendStarted := time.Now()
+	err := eventLog.Append(ctx.GetRaisedEvents())
+	if conf.metrics != nil {
+		conf.metrics.observeAppend(
+			commandLabels{cmdStruct.Key(), cmdStruct.MiddlewareChain()},
+			len(ctx.GetRaisedEvents()),
+			err,
+			time.Since(appendStarted))
+	}
+
+	if err != nil {
+		if errors.Is(err, eventlog.ErrConcurrencyConflict) {
+			return NewHttpError(http.StatusConflict, "event_append_conflict", err.Error())
+		}
+
+		return conf.internalError(fmt.Errorf("event append: %w", err), nil)
 	}
 
 	return nil
 }
+
+// exponential backoff with full jitter: sleeps random duration from [0, base * 2^attempt)
+func waitBeforeConflictRetry(ctx context.Context, base time.Duration, attempt int) error {
+	backoff := base << uint(attempt)
+	if backoff <= 0 { // base not set, or overflow
+		return ctx.Err()
+	}
+
+	select {
+	case <-time.After(time.Duration(rand.Int63n(int64(backoff)))):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,192 @@
+package httpcommand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/function61/eventhorizon/pkg/ehevent"
+	"github.com/function61/eventkit/command"
+	"github.com/function61/eventkit/eventlog"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestRetryOnConflict(t *testing.T) {
+	log := &conflictingLog{conflictsLeft: 2}
+	invoker := &countingInvoker{}
+	refreshes := 0
+
+	ctx := newTestCtx()
+
+	herr := InvokeSkippingAuthorization(&testCommand{}, ctx, invoker, log, RetryOnConflict(3, func(_ context.Context) error {
+		refreshes++
+		return nil
+	}), ConflictBackoff(time.Microsecond))
+	assert.Assert(t, herr == nil)
+
+	assert.Assert(t, invoker.invocations == 3)
+	assert.Assert(t, refreshes == 2)
+	// would be 3 without resetting context between attempts
+	assert.Assert(t, len(log.appended) == 1)
+	assert.EqualString(t, ctx.GetCreatedRecordId(), "id3")
+}
+
+func TestRetryOnConflictGivesUp(t *testing.T) {
+	log := &conflictingLog{conflictsLeft: 5}
+	invoker := &countingInvoker{}
+
+	herr := InvokeSkippingAuthorization(&testCommand{}, newTestCtx(), invoker, log, RetryOnConflict(1, nil), ConflictBackoff(time.Microsecond))
+	assert.EqualString(t, herr.Error(), "event_append_conflict: stream moved: eventlog: concurrency conflict")
+	assert.Assert(t, herr.StatusCode == 409)
+
+	assert.Assert(t, invoker.invocations == 2)
+}
+
+func TestNoRetryByDefault(t *testing.T) {
+	invoker := &countingInvoker{}
+
+	herr := InvokeSkippingAuthorization(&testCommand{}, newTestCtx(), invoker, &conflictingLog{conflictsLeft: 1})
+	assert.EqualString(t, herr.ErrorCode, "event_append_conflict")
+
+	assert.Assert(t, invoker.invocations == 1)
+}
+
+func newTestCtx() *command.Ctx {
+	return command.NewCtx(context.Background(), ehevent.Meta(time.Now(), "u1"), "", "")
+}
+
+type testCommand struct{}
+
+func (t *testCommand) Key() string             { return "test.Command" }
+func (t *testCommand) Validate() error         { return nil }
+func (t *testCommand) MiddlewareChain() string { return "public" }
+
+type countingInvoker struct {
+	invocations int
+}
+
+func (c *countingInvoker) Invoke(_ command.Command, ctx *command.Ctx) error {
+	c.invocations++
+
+	ctx.RaisesEvent(testEvent{})
+	ctx.CreatedRecordId(fmt.Sprintf("id%d", c.invocations))
+
+	return nil
+}
+
+type conflictingLog struct {
+	conflictsLeft int
+	appended      []ehevent.Event
+}
+
+func (c *conflictingLog) Append(events []ehevent.Event) error {
+	if c.conflictsLeft > 0 {
+		c.conflictsLeft--
+		return fmt.Errorf("stream moved: %w", eventlog.ErrConcurrencyConflict)
+	}
+
+	c.appended = append(c.appended, events...)
+
+	return nil
+}
+
+type testEvent struct{}
+
+func (t testEvent) MetaType() string         { return "test.Event" }
+func (t testEvent) Meta() *ehevent.EventMeta { return &ehevent.EventMeta{} }
+
+func TestPanicIsRecoveredAndReported(t *testing.T) {
+	var reported error
+	var reportedStack []byte
+
+	herr := InvokeSkippingAuthorization(&testCommand{}, newTestCtx(), invokerFunc(func(_ command.Command, _ *command.Ctx) error {
+		panic("bad validation_regex")
+	}), &conflictingLog{}, ReportInternalErrorsTo(func(err error, stack []byte) {
+		reported = err
+		reportedStack = stack
+	}))
+
+	assert.Assert(t, herr.StatusCode == 500)
+	assert.Assert(t, herr.IsServerError())
+	assert.EqualString(t, herr.Error(), "internal_error")
+	assert.EqualString(t, reported.Error(), "panic: bad validation_regex")
+	assert.Assert(t, len(reportedStack) > 0)
+}
+
+func TestErrorClassification(t *testing.T) {
+	invoke := func(handlerErr error) (*HttpError, error) {
+		var reported error
+
+		herr := InvokeSkippingAuthorization(&testCommand{}, newTestCtx(), invokerFunc(func(_ command.Command, _ *command.Ctx) error {
+			return handlerErr
+		}), &conflictingLog{}, ReportInternalErrorsTo(func(err error, _ []byte) {
+			reported = err
+		}))
+
+		return herr, reported
+	}
+
+	herr, reported := invoke(ClientError(errors.New("name already taken")))
+	assert.EqualString(t, herr.Error(), "command_failed: name already taken")
+	assert.Assert(t, herr.StatusCode == http.StatusBadRequest)
+	assert.Assert(t, reported == nil)
+
+	herr, reported = invoke(fmt.Errorf("rename: %w", &command.ValidationError{Field: "Name", Code: "field_empty", Message: "field Name cannot be empty"}))
+	assert.EqualString(t, herr.Error(), "command_validation_failed: field Name cannot be empty")
+	assert.EqualString(t, herr.Validation.Code, "field_empty")
+	assert.Assert(t, reported == nil)
+
+	herr, reported = invoke(InternalError(errors.New("database unreachable")))
+	assert.EqualString(t, herr.Error(), "internal_error")
+	assert.Assert(t, herr.IsServerError())
+	assert.EqualString(t, reported.Error(), "database unreachable")
+
+	// unmarked errors are not assumed to be safe to show to the client
+	herr, reported = invoke(errors.New("dial tcp 10.0.0.5:5432: connection refused"))
+	assert.EqualString(t, herr.Error(), "internal_error")
+	assert.Assert(t, herr.StatusCode == http.StatusInternalServerError)
+	assert.EqualString(t, reported.Error(), "dial tcp 10.0.0.5:5432: connection refused")
+}
+
+func TestAppendFailureDoesNotLeakDetails(t *testing.T) {
+	var reported error
+
+	herr := InvokeSkippingAuthorization(&testCommand{}, newTestCtx(), &countingInvoker{}, failingLog{}, ReportInternalErrorsTo(func(err error, _ []byte) {
+		reported = err
+	}))
+
+	assert.EqualString(t, herr.Error(), "internal_error")
+	assert.Assert(t, herr.StatusCode == 500)
+	assert.EqualString(t, reported.Error(), "event append: disk full at /var/lib/events")
+}
+
+func TestNilReporterFallsBackToLogging(t *testing.T) {
+	logged := &strings.Builder{}
+	log.SetOutput(logged)
+	defer log.SetOutput(os.Stderr)
+
+	herr := InvokeSkippingAuthorization(&testCommand{}, newTestCtx(), invokerFunc(func(_ command.Command, _ *command.Ctx) error {
+		panic("oops")
+	}), &conflictingLog{}, ReportInternalErrorsTo(nil))
+
+	assert.EqualString(t, herr.Error(), "internal_error")
+	assert.Assert(t, strings.Contains(logged.String(), "httpcommand: panic: oops"))
+}
+
+type failingLog struct{}
+
+func (f failingLog) Append(_ []ehevent.Event) error {
+	return errors.New("disk full at /var/lib/events")
+}
+
+type invokerFunc func(cmd command.Command, ctx *command.Ctx) error
+
+func (i invokerFunc) Invoke(cmd command.Command, ctx *command.Ctx) error {
+	return i(cmd, ctx)
+}
@@ -0,0 +1,116 @@
+package httpcommand
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// clients send this so that retrying a request whose response got lost doesn't invoke
+	// the command twice
+	IdempotencyKeyHeaderKey = "Idempotency-Key"
+)
+
+// what a successfully invoked command responded with, for replaying it to a retried request
+type IdempotentResult struct {
+	CreatedRecordId string
+	Cookies         []*http.Cookie
+}
+
+// returned by IdempotencyStore.Get() if a request with the same key is being processed
+var ErrIdempotencyKeyInFlight = errors.New("request with the same idempotency key is being processed")
+
+type IdempotencyStore interface {
+	// result of an earlier successful invocation with the key. if there's none, the key gets
+	// reserved for the caller, and others get ErrIdempotencyKeyInFlight until the caller calls
+	// Put() (success) or Release() (failure, so the key can be retried)
+	Get(key string) (*IdempotentResult, error)
+	Put(key string, result IdempotentResult)
+	Release(key string)
+}
+
+// remembers results of commands invoked with Idempotency-Key header and responds to
+// repeated requests with the remembered result instead of invoking the command again.
+// a repeated request arriving while the first one is still being processed (e.g. the client
+// timed out and retried) gets 409 "idempotency_key_in_flight" with Retry-After.
+//
+// only requests by authenticated users are deduplicated. results (which can contain session
+// cookies) are replayed only to the same user.
+func DeduplicateWith(store IdempotencyStore) Option {
+	return func(conf *config) {
+		conf.idempotencyStore = store
+	}
+}
+
+type memoryIdempotencyStore struct {
+	ttl        time.Duration
+	mu         sync.Mutex
+	results    map[string]memoryIdempotencyStoreItem
+	lastPruned time.Time
+}
+
+type memoryIdempotencyStoreItem struct {
+	result  *IdempotentResult // nil if in flight
+	expires time.Time         // in-flight reservations expire as well, in case the holder crashed
+}
+
+// results are remembered for ttl. memory use is proportional to command rate * ttl
+func NewMemoryIdempotencyStore(ttl time.Duration) IdempotencyStore {
+	return &memoryIdempotencyStore{
+		ttl:     ttl,
+		results: map[string]memoryIdempotencyStoreItem{},
+	}
+}
+
+func (m *memoryIdempotencyStore) Get(key string) (*IdempotentResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	if item, found := m.results[key]; found && !now.After(item.expires) {
+		if item.result == nil {
+			return nil, ErrIdempotencyKeyInFlight
+		}
+
+		return item.result, nil
+	}
+
+	m.store(key, nil, now)
+
+	return nil, nil
+}
+
+func (m *memoryIdempotencyStore) Put(key string, result IdempotentResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.store(key, &result, time.Now())
+}
+
+func (m *memoryIdempotencyStore) Release(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.results, key)
+}
+
+func (m *memoryIdempotencyStore) store(key string, result *IdempotentResult, now time.Time) {
+	// piggyback expiration on writes so we don't need a background goroutine
+	if now.Sub(m.lastPruned) > m.ttl {
+		for existingKey, item := range m.results {
+			if now.After(item.expires) {
+				delete(m.results, existingKey)
+			}
+		}
+
+		m.lastPruned = now
+	}
+
+	m.results[key] = memoryIdempotencyStoreItem{
+		result:  result,
+		expires: now.Add(m.ttl),
+	}
+}
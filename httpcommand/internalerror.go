@@ -0,0 +1,107 @@
+package httpcommand
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/function61/eventkit/command"
+)
+
+// receives server-side faults (panics, errors marked with InternalError() etc.) along with
+// a stack trace. the client only gets an opaque "internal_error" so details go here.
+type InternalErrorReporter func(err error, stack []byte)
+
+func logInternalError(err error, stack []byte) {
+	log.Printf("httpcommand: %v\n%s", err, stack)
+}
+
+type internalError struct {
+	err   error
+	stack []byte
+}
+
+func (i *internalError) Error() string {
+	return i.err.Error()
+}
+
+func (i *internalError) Unwrap() error {
+	return i.err
+}
+
+// marks an error returned by a command handler as a server-side fault (database outage etc.),
+// capturing the stack trace at the point of marking. the client gets an opaque 500 and the
+// error gets delivered to the InternalErrorReporter.
+//
+// unmarked errors are server-side faults as well, but without a stack trace.
+func InternalError(err error) error {
+	return &internalError{err, debug.Stack()}
+}
+
+func IsInternalError(err error) bool {
+	var ie *internalError
+	return errors.As(err, &ie)
+}
+
+type clientError struct {
+	err error
+}
+
+func (c *clientError) Error() string {
+	return c.err.Error()
+}
+
+func (c *clientError) Unwrap() error {
+	return c.err
+}
+
+// marks an error returned by a command handler as caused by the client (name already taken
+// etc.), i.e. retrying the same request won't help. the client gets a 400 "command_failed" with
+// the error message as the description, so don't put server internals in it.
+func ClientError(err error) error {
+	return &clientError{err}
+}
+
+func IsClientError(err error) bool {
+	var ce *clientError
+	return errors.As(err, &ce)
+}
+
+// maps an error returned by a command handler to a response
+func (c *config) handlerError(err error) *HttpError {
+	var httpErr *HttpError
+	var clientErr *clientError
+	var validationErr *command.ValidationError
+	var internalErr *internalError
+
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr // use as-is
+	case errors.As(err, &clientErr):
+		return badRequest("command_failed", clientErr.Error())
+	case errors.As(err, &validationErr):
+		herr := badRequest("command_validation_failed", validationErr.Error())
+		herr.Validation = validationErr
+		return herr
+	case errors.As(err, &internalErr):
+		return c.internalError(internalErr.err, internalErr.stack)
+	default: // not marked as client's fault, so safer to not leak details
+		return c.internalError(err, nil)
+	}
+}
+
+// reports the fault and returns a response that doesn't leak details
+func (c *config) internalError(err error, stack []byte) *HttpError {
+	c.internalErrorReporter(err, stack)
+
+	return NewHttpError(http.StatusInternalServerError, "internal_error", "")
+}
+
+// usage: defer conf.recoverPanic(&herr)
+func (c *config) recoverPanic(herr **HttpError) {
+	if recovered := recover(); recovered != nil {
+		*herr = c.internalError(fmt.Errorf("panic: %v", recovered), debug.Stack())
+	}
+}
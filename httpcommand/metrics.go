@@ -0,0 +1,225 @@
+package httpcommand
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// same as Prometheus client's default buckets (seconds)
+var metricsLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// per-command metrics. record them by passing WithMetrics() to Serve() or
+// InvokeSkippingAuthorization(), and expose them to Prometheus by mounting this as a
+// http.Handler (it speaks the text exposition format).
+type Metrics struct {
+	mu             sync.Mutex
+	invocations    map[invocationLabels]uint64
+	latency        map[commandLabels]*histogram
+	eventsAppended map[commandLabels]uint64
+	appendLatency  map[commandLabels]*histogram
+}
+
+var _ http.Handler = (*Metrics)(nil)
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		invocations:    map[invocationLabels]uint64{},
+		latency:        map[commandLabels]*histogram{},
+		eventsAppended: map[commandLabels]uint64{},
+		appendLatency:  map[commandLabels]*histogram{},
+	}
+}
+
+func WithMetrics(metrics *Metrics) Option {
+	return func(conf *config) {
+		conf.metrics = metrics
+	}
+}
+
+type commandLabels struct {
+	command string // Command.Key()
+	chain   string // Command.MiddlewareChain()
+}
+
+type invocationLabels struct {
+	commandLabels
+	outcome string // "ok" | "idempotent_replay" | "middleware_rejected" | HttpError.ErrorCode
+}
+
+func invocationOutcome(herr *HttpError, replayed bool) string {
+	switch {
+	case herr == nil && replayed:
+		return "idempotent_replay"
+	case herr == nil:
+		return "ok"
+	case herr.ErrorResponseAlreadySentByMiddleware():
+		return "middleware_rejected"
+	default:
+		return herr.ErrorCode
+	}
+}
+
+func (m *Metrics) observeInvocation(labels commandLabels, outcome string, took time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.invocations[invocationLabels{labels, outcome}]++
+	histogramFor(m.latency, labels).observe(took.Seconds())
+}
+
+func (m *Metrics) observeAppend(labels commandLabels, eventCount int, err error, took time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		m.eventsAppended[labels] += uint64(eventCount)
+	}
+
+	histogramFor(m.appendLatency, labels).observe(took.Seconds())
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	if err := m.WriteText(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writes metrics in Prometheus text exposition format
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := &strings.Builder{}
+
+	writeHeader := func(name string, typ string, help string) {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	writeHeader("eventkit_command_invocations_total", "counter", "Command invocations by outcome (\"ok\" or error code).")
+	invocationKeys := make([]invocationLabels, 0, len(m.invocations))
+	for key := range m.invocations {
+		invocationKeys = append(invocationKeys, key)
+	}
+	sort.Slice(invocationKeys, func(i, j int) bool {
+		if invocationKeys[i].commandLabels != invocationKeys[j].commandLabels {
+			return invocationKeys[i].commandLabels.less(invocationKeys[j].commandLabels)
+		}
+
+		return invocationKeys[i].outcome < invocationKeys[j].outcome
+	})
+	for _, key := range invocationKeys {
+		fmt.Fprintf(out, "eventkit_command_invocations_total{%s,outcome=\"%s\"} %d\n",
+			key.commandLabels.serialize(),
+			escapeLabelValue(key.outcome),
+			m.invocations[key])
+	}
+
+	writeHeader("eventkit_command_duration_seconds", "histogram", "Time taken to process a command invocation (parsing, validation, handling and appending events).")
+	writeHistograms(out, "eventkit_command_duration_seconds", m.latency)
+
+	writeHeader("eventkit_command_events_appended_total", "counter", "Events appended to the event log by command.")
+	for _, key := range sortCommandLabels(counterLabels(m.eventsAppended)) {
+		fmt.Fprintf(out, "eventkit_command_events_appended_total{%s} %d\n", key.serialize(), m.eventsAppended[key])
+	}
+
+	writeHeader("eventkit_command_append_duration_seconds", "histogram", "Time taken to append a command's events to the event log.")
+	writeHistograms(out, "eventkit_command_append_duration_seconds", m.appendLatency)
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func writeHistograms(out io.Writer, name string, histograms map[commandLabels]*histogram) {
+	for _, key := range sortCommandLabels(histogramLabels(histograms)) {
+		hist := histograms[key]
+		labels := key.serialize()
+
+		for idx, upperBound := range metricsLatencyBuckets {
+			fmt.Fprintf(out, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(upperBound), hist.cumulativeCounts[idx])
+		}
+		fmt.Fprintf(out, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, hist.count)
+		fmt.Fprintf(out, "%s_sum{%s} %s\n", name, labels, formatFloat(hist.sum))
+		fmt.Fprintf(out, "%s_count{%s} %d\n", name, labels, hist.count)
+	}
+}
+
+type histogram struct {
+	cumulativeCounts []uint64 // for each of metricsLatencyBuckets
+	count            uint64
+	sum              float64
+}
+
+func histogramFor(histograms map[commandLabels]*histogram, labels commandLabels) *histogram {
+	hist, found := histograms[labels]
+	if !found {
+		hist = &histogram{cumulativeCounts: make([]uint64, len(metricsLatencyBuckets))}
+		histograms[labels] = hist
+	}
+
+	return hist
+}
+
+func (h *histogram) observe(value float64) {
+	for idx, upperBound := range metricsLatencyBuckets {
+		if value <= upperBound {
+			h.cumulativeCounts[idx]++
+		}
+	}
+
+	h.count++
+	h.sum += value
+}
+
+func (c commandLabels) less(other commandLabels) bool {
+	if c.command != other.command {
+		return c.command < other.command
+	}
+
+	return c.chain < other.chain
+}
+
+func (c commandLabels) serialize() string {
+	return fmt.Sprintf(`command="%s",chain="%s"`, escapeLabelValue(c.command), escapeLabelValue(c.chain))
+}
+
+func counterLabels(counters map[commandLabels]uint64) []commandLabels {
+	keys := make([]commandLabels, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func histogramLabels(histograms map[commandLabels]*histogram) []commandLabels {
+	keys := make([]commandLabels, 0, len(histograms))
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func sortCommandLabels(keys []commandLabels) []commandLabels {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+
+	return keys
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(val string) string {
+	return labelValueEscaper.Replace(val)
+}
+
+func formatFloat(val float64) string {
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
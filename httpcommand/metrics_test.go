@@ -0,0 +1,108 @@
+package httpcommand
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/function61/eventkit/command"
+	"github.com/function61/gokit/net/http/httpauth"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+
+	invoke := func(log *conflictingLog) {
+		_ = InvokeSkippingAuthorization(&testCommand{}, newTestCtx(), &countingInvoker{}, log, WithMetrics(metrics))
+	}
+
+	invoke(&conflictingLog{})
+	invoke(&conflictingLog{})
+	invoke(&conflictingLog{conflictsLeft: 1})
+
+	out := &strings.Builder{}
+	assert.Assert(t, metrics.WriteText(out) == nil)
+
+	hasLine := func(line string) bool {
+		return metricsHaveLine(out.String(), line)
+	}
+
+	assert.Assert(t, hasLine(`# TYPE eventkit_command_invocations_total counter`))
+	assert.Assert(t, hasLine(`eventkit_command_invocations_total{command="test.Command",chain="public",outcome="event_append_conflict"} 1`))
+	assert.Assert(t, hasLine(`eventkit_command_invocations_total{command="test.Command",chain="public",outcome="ok"} 2`))
+	assert.Assert(t, hasLine(`eventkit_command_duration_seconds_count{command="test.Command",chain="public"} 3`))
+	assert.Assert(t, hasLine(`eventkit_command_duration_seconds_bucket{command="test.Command",chain="public",le="+Inf"} 3`))
+	assert.Assert(t, hasLine(`eventkit_command_events_appended_total{command="test.Command",chain="public"} 2`))
+	assert.Assert(t, hasLine(`eventkit_command_append_duration_seconds_count{command="test.Command",chain="public"} 3`))
+}
+
+func TestMetricsCountServeOutcomes(t *testing.T) {
+	metrics := NewMetrics()
+
+	router, err := NewRouter("/command/", httpauth.MiddlewareChainMap{
+		"public": func(w http.ResponseWriter, r *http.Request) *httpauth.RequestContext {
+			if r.Header.Get("X-Reject") != "" {
+				http.Error(w, "go away", http.StatusForbidden)
+				return nil
+			}
+
+			return &httpauth.RequestContext{User: &httpauth.UserDetails{Id: "u1"}}
+		},
+	}, &conflictingLog{}, []Module{
+		{
+			Allocators: command.Allocators{
+				"test.Command": func() command.Command { return &testCommand{} },
+			},
+			Invoker: &countingInvoker{},
+		},
+	}, WithMetrics(metrics), DeduplicateWith(NewMemoryIdempotencyStore(time.Minute)))
+	assert.Assert(t, err == nil)
+
+	post := func(path string, contentType string, body string, headers ...string) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	post("/command/test.Command", "application/json", `{}`)
+	post("/command/test.Command", "application/json", `{}`, IdempotencyKeyHeaderKey, "k1")
+	post("/command/test.Command", "application/json", `{}`, IdempotencyKeyHeaderKey, "k1")
+	post("/command/test.Command", "text/plain", `{}`)
+	post("/command/test.Command", "application/json", `{"nope": 1}`)
+	post("/command/test.Command", "application/json", `{}`, "X-Reject", "1")
+	post("/command/nonexistent.Command", "application/json", `{}`)
+
+	out := &strings.Builder{}
+	assert.Assert(t, metrics.WriteText(out) == nil)
+
+	for _, line := range []string{
+		// not double counted even though Serve() invokes via InvokeSkippingAuthorization()'s internals
+		`eventkit_command_invocations_total{command="test.Command",chain="public",outcome="ok"} 2`,
+		`eventkit_command_invocations_total{command="test.Command",chain="public",outcome="idempotent_replay"} 1`,
+		`eventkit_command_invocations_total{command="test.Command",chain="public",outcome="expecting_content_type_json"} 1`,
+		`eventkit_command_invocations_total{command="test.Command",chain="public",outcome="json_parsing_failed"} 1`,
+		`eventkit_command_invocations_total{command="test.Command",chain="public",outcome="middleware_rejected"} 1`,
+		`eventkit_command_invocations_total{command="",chain="",outcome="unsupported_command"} 1`,
+		`eventkit_command_duration_seconds_count{command="test.Command",chain="public"} 6`,
+	} {
+		if !metricsHaveLine(out.String(), line) {
+			t.Errorf("missing line: %s\n%s", line, out.String())
+		}
+	}
+}
+
+func metricsHaveLine(out string, line string) bool {
+	for _, candidate := range strings.Split(out, "\n") {
+		if candidate == line {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,64 @@
+package httpcommand
+
+import (
+	"context"
+	"time"
+)
+
+// optional behaviour for Serve() and InvokeSkippingAuthorization()
+type Option func(*config)
+
+type config struct {
+	conflictRetries  int
+	conflictBackoff  time.Duration
+	refreshReadModel func(ctx context.Context) error
+
+	internalErrorReporter InternalErrorReporter
+
+	metrics *Metrics // nil if not in use
+
+	idempotencyStore IdempotencyStore // nil if not in use
+}
+
+func newConfig(opts []Option) *config {
+	conf := &config{
+		conflictBackoff:       20 * time.Millisecond,
+		internalErrorReporter: logInternalError,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return conf
+}
+
+// when appending events fails due to a concurrency conflict, refreshes the read model and
+// re-runs the command handler (with a fresh context) up to maxRetries times.
+// refreshReadModel is needed because the handler would otherwise make its decisions based
+// on the same stale state that caused the conflict in the first place.
+func RetryOnConflict(maxRetries int, refreshReadModel func(ctx context.Context) error) Option {
+	return func(conf *config) {
+		conf.conflictRetries = maxRetries
+		conf.refreshReadModel = refreshReadModel
+	}
+}
+
+// base duration for exponential backoff between conflict retries. uses full jitter: the wait
+// before nth retry is random in [0, base * 2^(n-1)), so competing writers don't retry in lockstep
+func ConflictBackoff(base time.Duration) Option {
+	return func(conf *config) {
+		conf.conflictBackoff = base
+	}
+}
+
+// where panics and other server-side faults get reported to. default (also if nil): standard logger
+func ReportInternalErrorsTo(reporter InternalErrorReporter) Option {
+	return func(conf *config) {
+		if reporter == nil {
+			reporter = logInternalError
+		}
+
+		conf.internalErrorReporter = reporter
+	}
+}
@@ -0,0 +1,105 @@
+package httpcommand
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/function61/eventkit/command"
+	"github.com/function61/eventkit/eventlog"
+	"github.com/function61/gokit/net/http/httpauth"
+)
+
+// commands of one module, i.e. what the module's generated commanddefinitions.gen.go gives you
+type Module struct {
+	Allocators command.Allocators
+	Invoker    command.Invoker
+}
+
+// serves POST <prefix><command name> for commands of all the mounted modules
+type Router struct {
+	prefix   string
+	mwares   httpauth.MiddlewareChainMap
+	eventLog eventlog.Log
+	opts     []Option
+	modules  map[string]Module // keyed by command name
+}
+
+var _ http.Handler = (*Router)(nil)
+
+// prefix looks like "/command/". opts are passed to each Serve() call.
+// returns error if two modules define a command with the same name.
+func NewRouter(
+	prefix string,
+	mwares httpauth.MiddlewareChainMap,
+	eventLog eventlog.Log,
+	modules []Module,
+	opts ...Option,
+) (*Router, error) {
+	moduleByCommand := map[string]Module{}
+
+	for _, module := range modules {
+		for commandName := range module.Allocators {
+			if _, collides := moduleByCommand[commandName]; collides {
+				return nil, fmt.Errorf("NewRouter: command %s defined by more than one module", commandName)
+			}
+
+			moduleByCommand[commandName] = module
+		}
+	}
+
+	return &Router{
+		prefix:   prefix,
+		mwares:   mwares,
+		eventLog: eventLog,
+		opts:     opts,
+		modules:  moduleByCommand,
+	}, nil
+}
+
+func (c *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, c.serve(w, r))
+}
+
+func (c *Router) serve(w http.ResponseWriter, r *http.Request) *HttpError {
+	if !strings.HasPrefix(r.URL.Path, c.prefix) {
+		return NewHttpError(http.StatusNotFound, "not_found", "")
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return NewHttpError(http.StatusMethodNotAllowed, "method_not_allowed", "commands are invoked with POST")
+	}
+
+	// "/command/user.Create" => "user.Create"
+	commandName := strings.TrimPrefix(r.URL.Path, c.prefix)
+
+	// zero value for unknown commands, which Serve() responds to (and observes) as unsupported
+	module := c.modules[commandName]
+
+	return Serve(w, r, c.mwares, commandName, module.Allocators, module.Invoker, c.eventLog, c.opts...)
+}
+
+// wire format of an error response
+type ErrorResponse struct {
+	ErrorCode        string                   `json:"error_code"`
+	ErrorDescription string                   `json:"error_description"`
+	Validation       *command.ValidationError `json:"validation,omitempty"`
+}
+
+// writes error (if any) as a JSON response. use this to respond with the result of Serve().
+func WriteError(w http.ResponseWriter, herr *HttpError) {
+	if herr == nil || herr.ErrorResponseAlreadySentByMiddleware() {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(herr.StatusCode)
+
+	_ = json.NewEncoder(w).Encode(ErrorResponse{
+		ErrorCode:        herr.ErrorCode,
+		ErrorDescription: herr.Description,
+		Validation:       herr.Validation,
+	})
+}
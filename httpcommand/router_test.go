@@ -0,0 +1,169 @@
+package httpcommand
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/function61/eventkit/command"
+	"github.com/function61/gokit/net/http/httpauth"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestRouter(t *testing.T) {
+	module := Module{
+		Allocators: command.Allocators{
+			"test.Command": func() command.Command { return &testCommand{} },
+		},
+		Invoker: &countingInvoker{},
+	}
+
+	mwares := httpauth.MiddlewareChainMap{
+		"public": func(w http.ResponseWriter, r *http.Request) *httpauth.RequestContext {
+			return &httpauth.RequestContext{}
+		},
+	}
+
+	_, err := NewRouter("/command/", mwares, &conflictingLog{}, []Module{module, module})
+	assert.EqualString(t, err.Error(), "NewRouter: command test.Command defined by more than one module")
+
+	module.Allocators["test.OldCommand"] = func() command.Command { return &deprecatedTestCommand{} }
+
+	router, err := NewRouter("/command/", mwares, &conflictingLog{}, []Module{module})
+	assert.Assert(t, err == nil)
+
+	post := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	res := post("/command/test.Command")
+	assert.Assert(t, res.Code == http.StatusOK)
+	assert.EqualString(t, res.Header().Get(CreatedRecordIdHeaderKey), "id1")
+	assert.EqualString(t, res.Header().Get(DeprecationHeaderKey), "")
+
+	res = post("/command/test.OldCommand")
+	assert.Assert(t, res.Code == http.StatusOK)
+	assert.EqualString(t, res.Header().Get(DeprecationHeaderKey), "true")
+
+	res = post("/command/nonexistent.Command")
+	assert.Assert(t, res.Code == http.StatusBadRequest)
+	assert.EqualString(t, res.Body.String(), `{"error_code":"unsupported_command","error_description":""}`+"\n")
+}
+
+func TestDeduplicateWithIdempotencyKey(t *testing.T) {
+	invoker := &countingInvoker{}
+	failNext := false
+
+	router, err := NewRouter("/command/", httpauth.MiddlewareChainMap{
+		"public": func(w http.ResponseWriter, r *http.Request) *httpauth.RequestContext {
+			if userId := r.Header.Get("X-User"); userId != "" {
+				return &httpauth.RequestContext{User: &httpauth.UserDetails{Id: userId}}
+			}
+
+			return &httpauth.RequestContext{}
+		},
+	}, &conflictingLog{}, []Module{
+		{
+			Allocators: command.Allocators{
+				"test.Command": func() command.Command { return &testCommand{} },
+			},
+			Invoker: invokerFunc(func(cmd command.Command, ctx *command.Ctx) error {
+				if failNext {
+					failNext = false
+					return ClientError(errors.New("try again"))
+				}
+
+				return invoker.Invoke(cmd, ctx)
+			}),
+		},
+	}, DeduplicateWith(NewMemoryIdempotencyStore(time.Minute)))
+	assert.Assert(t, err == nil)
+
+	post := func(userId string, idempotencyKey string) string {
+		req := httptest.NewRequest(http.MethodPost, "/command/test.Command", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User", userId)
+		req.Header.Set(IdempotencyKeyHeaderKey, idempotencyKey)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res.Header().Get(CreatedRecordIdHeaderKey)
+	}
+
+	assert.EqualString(t, post("u1", "key1"), "id1")
+	assert.EqualString(t, post("u1", "key1"), "id1") // replayed
+	assert.EqualString(t, post("u1", "key2"), "id2")
+	assert.EqualString(t, post("u2", "key1"), "id3") // scoped to user
+
+	// anonymous requests are not deduplicated
+	assert.EqualString(t, post("", "key3"), "id4")
+	assert.EqualString(t, post("", "key3"), "id5")
+
+	// failed invocation doesn't leave the key reserved
+	failNext = true
+	assert.EqualString(t, post("u1", "key4"), "")
+	assert.EqualString(t, post("u1", "key4"), "id6")
+
+	assert.Assert(t, invoker.invocations == 6)
+}
+
+func TestIdempotencyKeyInFlight(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Minute)
+
+	result, err := store.Get("k")
+	assert.Assert(t, result == nil && err == nil) // reserved for us
+
+	_, err = store.Get("k")
+	assert.Assert(t, err == ErrIdempotencyKeyInFlight)
+
+	store.Release("k")
+
+	result, err = store.Get("k")
+	assert.Assert(t, result == nil && err == nil)
+
+	store.Put("k", IdempotentResult{CreatedRecordId: "id1"})
+
+	result, err = store.Get("k")
+	assert.Assert(t, err == nil)
+	assert.EqualString(t, result.CreatedRecordId, "id1")
+
+	// concurrent duplicate gets a retryable conflict
+	router, errRouter := NewRouter("/command/", httpauth.MiddlewareChainMap{
+		"public": func(w http.ResponseWriter, r *http.Request) *httpauth.RequestContext {
+			return &httpauth.RequestContext{User: &httpauth.UserDetails{Id: "u1"}}
+		},
+	}, &conflictingLog{}, []Module{
+		{
+			Allocators: command.Allocators{
+				"test.Command": func() command.Command { return &testCommand{} },
+			},
+			Invoker: &countingInvoker{},
+		},
+	}, DeduplicateWith(store))
+	assert.Assert(t, errRouter == nil)
+
+	_, _ = store.Get("u1/test.Command/k2") // as if another request was processing it
+
+	req := httptest.NewRequest(http.MethodPost, "/command/test.Command", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyKeyHeaderKey, "k2")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Assert(t, res.Code == http.StatusConflict)
+	assert.EqualString(t, res.Header().Get("Retry-After"), "1")
+	assert.EqualString(t, res.Body.String(), `{"error_code":"idempotency_key_in_flight","error_description":"request with the same idempotency key is being processed"}`+"\n")
+}
+
+type deprecatedTestCommand struct {
+	testCommand
+}
+
+func (d *deprecatedTestCommand) Key() string         { return "test.OldCommand" }
+func (d *deprecatedTestCommand) Deprecation() string { return "Use test.Command instead." }
@@ -0,0 +1,208 @@
+package httpcommandclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// adds credentials to requests
+type AuthProvider interface {
+	Apply(ctx context.Context, req *http.Request) error
+	// called when server responds with 401. returns false if there was nothing to refresh,
+	// otherwise the request is retried (only once, even if it fails with 401 again)
+	Refresh(ctx context.Context) (bool, error)
+}
+
+// optionally implemented by AuthProviders that need to see responses
+type ResponseObserver interface {
+	ObserveResponse(res *http.Response)
+}
+
+func WithAuth(auth AuthProvider) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+type staticToken struct {
+	token string
+}
+
+// bearer token that never changes. empty token means no authentication
+func StaticToken(token string) AuthProvider {
+	return &staticToken{token}
+}
+
+func (s *staticToken) Apply(_ context.Context, req *http.Request) error {
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	return nil
+}
+
+func (s *staticToken) Refresh(_ context.Context) (bool, error) {
+	return false, nil
+}
+
+// fetches a new token, e.g. a short-lived JWT from an identity provider
+type TokenFetcher func(ctx context.Context) (token string, expires time.Time, err error)
+
+type refreshingToken struct {
+	fetch    TokenFetcher
+	mu       sync.Mutex
+	token    string
+	expires  time.Time
+	inflight *tokenFetch // concurrent refreshes wait for this instead of fetching again
+}
+
+type tokenFetch struct {
+	done     chan struct{}
+	err      error
+	canceled bool // initiator's ctx ended, so waiters shouldn't take the error as their own
+}
+
+// bearer token that is fetched on first use and re-fetched when it's about to expire or
+// when the server says it's no longer valid
+func RefreshingToken(fetch TokenFetcher) AuthProvider {
+	return &refreshingToken{fetch: fetch}
+}
+
+func (r *refreshingToken) Apply(ctx context.Context, req *http.Request) error {
+	token := r.currentToken()
+	if token == "" {
+		if err := r.refresh(ctx); err != nil {
+			return err
+		}
+
+		// freshly fetched, so use it even if it's short-lived
+		r.mu.Lock()
+		token = r.token
+		r.mu.Unlock()
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return nil
+}
+
+func (r *refreshingToken) Refresh(ctx context.Context) (bool, error) {
+	if err := r.refresh(ctx); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// empty if we don't have a token that is usable for a while
+func (r *refreshingToken) currentToken() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// margin so the token doesn't expire while the request is in flight
+	if time.Now().Add(30 * time.Second).After(r.expires) {
+		return ""
+	}
+
+	return r.token
+}
+
+// starts a fetch or joins one that is already in flight. waiting respects ctx.
+func (r *refreshingToken) refresh(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		fetch := r.inflight
+		if fetch == nil {
+			fetch = &tokenFetch{done: make(chan struct{})}
+			r.inflight = fetch
+			r.mu.Unlock()
+
+			r.runFetch(ctx, fetch)
+
+			return fetch.err
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-fetch.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if !fetch.canceled {
+			return fetch.err
+		}
+		// initiator gave up => try again with our ctx
+	}
+}
+
+func (r *refreshingToken) runFetch(ctx context.Context, fetch *tokenFetch) {
+	fetch.err = errors.New("token fetch panicked")
+
+	defer func() {
+		r.mu.Lock()
+		r.inflight = nil
+		r.mu.Unlock()
+
+		close(fetch.done)
+	}()
+
+	token, expires, err := r.fetch(ctx)
+	if err != nil {
+		fetch.err = err
+		fetch.canceled = ctx.Err() != nil
+		return
+	}
+
+	r.mu.Lock()
+	r.token = token
+	r.expires = expires
+	r.mu.Unlock()
+
+	fetch.err = nil
+}
+
+type cookieJar struct {
+	jar   http.CookieJar
+	login func(ctx context.Context) error
+}
+
+// session cookies, like the ones set by a login command with command.Ctx.AddCookie().
+// cookies from responses are stored in the jar and sent with subsequent requests.
+//
+// login (optional) is called on 401 to get a new session. it must not use a Client that
+// uses this provider (it'd recurse on 401) but it should share the jar, e.g.:
+//
+//	loginClient := New(url, "", nil, WithAuth(CookieJar(jar, nil)))
+func CookieJar(jar http.CookieJar, login func(ctx context.Context) error) AuthProvider {
+	return &cookieJar{jar, login}
+}
+
+func (c *cookieJar) Apply(_ context.Context, req *http.Request) error {
+	for _, cookie := range c.jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+
+	return nil
+}
+
+func (c *cookieJar) Refresh(ctx context.Context) (bool, error) {
+	if c.login == nil {
+		return false, nil
+	}
+
+	if err := c.login(ctx); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *cookieJar) ObserveResponse(res *http.Response) {
+	if cookies := res.Cookies(); len(cookies) > 0 {
+		c.jar.SetCookies(res.Request.URL, cookies)
+	}
+}
@@ -2,31 +2,47 @@
 package httpcommandclient
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/function61/eventkit/command"
 	"github.com/function61/eventkit/httpcommand"
-	"github.com/function61/gokit/net/http/ezhttp"
 )
 
 type Client struct {
 	baseUrl     string // looks like "http://localhost/command/"
-	bearerToken string
+	auth        AuthProvider
 	httpClient  *http.Client
+	retryPolicy RetryPolicy
 }
 
-func New(baseUrl string, bearerToken string, httpClient *http.Client) *Client {
+type Option func(*Client)
+
+// use WithAuth() option for other authentication schemes than a static bearer token
+func New(baseUrl string, bearerToken string, httpClient *http.Client, opts ...Option) *Client {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
 
-	return &Client{
+	client := &Client{
 		baseUrl:     baseUrl,
-		bearerToken: bearerToken,
+		auth:        StaticToken(bearerToken),
 		httpClient:  httpClient,
+		retryPolicy: noRetries,
+	}
+
+	for _, opt := range opts {
+		opt(client)
 	}
+
+	return client
 }
 
 func (c *Client) Exec(ctx context.Context, cmdStruct command.Command) error {
@@ -53,15 +69,114 @@ func (c *Client) execInternal(ctx context.Context, cmdStruct command.Command) (*
 		return nil, err
 	}
 
-	res, err := ezhttp.Post(
-		ctx,
-		c.baseUrl+cmdStruct.Key(),
-		ezhttp.AuthBearer(c.bearerToken),
-		ezhttp.SendJson(cmdStruct),
-		ezhttp.Client(c.httpClient))
+	// same key for all attempts, so the server knows not to invoke the command again if it
+	// was the response (and not the request) that got lost
+	idempotencyKey, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(cmdStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.execWithRetries(ctx, cmdStruct.Key(), body, idempotencyKey)
+}
+
+// one attempt. returns the response also on non-2xx so its headers can be inspected
+func (c *Client) execOnce(
+	ctx context.Context,
+	commandName string,
+	body []byte,
+	idempotencyKey string,
+) (*http.Response, error) {
+	res, err := c.send(ctx, commandName, body, idempotencyKey)
 	if err != nil {
 		return nil, err
 	}
 
+	// credentials might've expired. refresh once and try again
+	if res.StatusCode == http.StatusUnauthorized {
+		refreshed, err := c.auth.Refresh(ctx)
+		if err != nil {
+			res.Body.Close()
+			return nil, fmt.Errorf("refreshing credentials: %w", err)
+		}
+
+		if refreshed {
+			res.Body.Close()
+
+			res, err = c.send(ctx, commandName, body, idempotencyKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	defer res.Body.Close() // we're only interested in headers
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res, errorFromResponse(res)
+	}
+
 	return res, nil
 }
+
+func (c *Client) send(
+	ctx context.Context,
+	commandName string,
+	body []byte,
+	idempotencyKey string,
+) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, c.baseUrl+commandName, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(httpcommand.IdempotencyKeyHeaderKey, idempotencyKey)
+
+	if err := c.auth.Apply(ctx, req); err != nil {
+		return nil, err
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if observer, is := c.auth.(ResponseObserver); is {
+		observer.ObserveResponse(res)
+	}
+
+	return res, nil
+}
+
+// returns *httpcommand.HttpError so callers can branch on ErrorCode
+func errorFromResponse(res *http.Response) error {
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+
+	errResponse := httpcommand.ErrorResponse{}
+	if err := json.Unmarshal(body, &errResponse); err != nil || errResponse.ErrorCode == "" {
+		// not from httpcommand (maybe from a proxy or middleware)
+		return httpcommand.NewHttpError(
+			res.StatusCode,
+			"unexpected_response",
+			fmt.Sprintf("%s: %s", res.Status, strings.TrimSpace(string(body))))
+	}
+
+	herr := httpcommand.NewHttpError(res.StatusCode, errResponse.ErrorCode, errResponse.ErrorDescription)
+	herr.Validation = errResponse.Validation
+
+	return herr
+}
+
+// whether err is an error response from the server with the given code, like "command_validation_failed"
+func ErrorIs(err error, errorCode string) bool {
+	var httpErr *httpcommand.HttpError
+	return errors.As(err, &httpErr) && httpErr.ErrorCode == errorCode
+}
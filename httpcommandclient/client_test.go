@@ -0,0 +1,229 @@
+package httpcommandclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/function61/eventkit/command"
+	"github.com/function61/eventkit/httpcommand"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestTypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/command/test.Command":
+			herr := httpcommand.NewHttpError(http.StatusBadRequest, "command_validation_failed", "field Name cannot be empty")
+			herr.Validation = &command.ValidationError{Field: "Name", Code: "field_empty", Message: "field Name cannot be empty"}
+			httpcommand.WriteError(w, herr)
+		default:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.URL+"/command/", "", nil)
+
+	err := client.Exec(context.Background(), &testCommand{"test.Command"})
+	assert.EqualString(t, err.Error(), "command_validation_failed: field Name cannot be empty")
+	assert.Assert(t, ErrorIs(err, "command_validation_failed"))
+
+	var httpErr *httpcommand.HttpError
+	assert.Assert(t, errors.As(err, &httpErr))
+	assert.Assert(t, httpErr.IsClientError())
+	assert.EqualString(t, httpErr.Validation.Field, "Name")
+	assert.EqualString(t, httpErr.Validation.Code, "field_empty")
+
+	err = client.Exec(context.Background(), &testCommand{"proxied.Command"})
+	assert.EqualString(t, err.Error(), "unexpected_response: 502 Bad Gateway: bad gateway")
+	assert.Assert(t, errors.As(err, &httpErr))
+	assert.Assert(t, httpErr.IsServerError())
+}
+
+func TestRetries(t *testing.T) {
+	idempotencyKeys := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKeys = append(idempotencyKeys, r.Header.Get(httpcommand.IdempotencyKeyHeaderKey))
+
+		switch len(idempotencyKeys) {
+		case 1:
+			httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusServiceUnavailable, "internal_error", ""))
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusTooManyRequests, "rate_limited", ""))
+		case 3: // first attempt's processing didn't finish yet
+			w.Header().Set("Retry-After", "0")
+			httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusConflict, "idempotency_key_in_flight", ""))
+		case 4: // server's own conflict retries ran out
+			httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusConflict, "event_append_conflict", ""))
+		default:
+			w.Header().Set(httpcommand.CreatedRecordIdHeaderKey, "123")
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.URL+"/command/", "", nil, WithRetries(RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond,
+	}))
+
+	id, err := client.ExecExpectingCreatedRecordId(context.Background(), &testCommand{"test.Command"})
+	assert.Assert(t, err == nil)
+	assert.EqualString(t, id, "123")
+
+	assert.Assert(t, len(idempotencyKeys) == 5)
+	assert.Assert(t, len(idempotencyKeys[0]) == 32)
+	for _, key := range idempotencyKeys[1:] {
+		assert.EqualString(t, key, idempotencyKeys[0])
+	}
+}
+
+func TestRetryAfterLongerThanMaxBackoffGivesUp(t *testing.T) {
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "3600")
+		httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusServiceUnavailable, "maintenance", ""))
+	}))
+	defer server.Close()
+
+	client := New(server.URL+"/command/", "", nil, WithRetries(DefaultRetryPolicy))
+
+	started := time.Now()
+	assert.Assert(t, ErrorIs(client.Exec(context.Background(), &testCommand{"test.Command"}), "maintenance"))
+	assert.Assert(t, time.Since(started) < time.Second)
+	assert.Assert(t, attempts == 1)
+}
+
+func TestPermanentErrorsAreNotRetried(t *testing.T) {
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusBadRequest, "command_failed", "nope"))
+	}))
+	defer server.Close()
+
+	client := New(server.URL+"/command/", "", nil, WithRetries(DefaultRetryPolicy))
+
+	assert.Assert(t, ErrorIs(client.Exec(context.Background(), &testCommand{"test.Command"}), "command_failed"))
+	assert.Assert(t, attempts == 1)
+}
+
+func TestRefreshingTokenRefreshesOnceOn401(t *testing.T) {
+	validToken := "token2"
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+
+		if r.Header.Get("Authorization") != "Bearer "+validToken {
+			httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusUnauthorized, "unauthorized", ""))
+			return
+		}
+	}))
+	defer server.Close()
+
+	fetches := 0
+	client := New(server.URL+"/command/", "", nil, WithAuth(RefreshingToken(func(_ context.Context) (string, time.Time, error) {
+		fetches++
+		return fmt.Sprintf("token%d", fetches), time.Now().Add(time.Hour), nil
+	})))
+
+	// first token was revoked => refreshed
+	assert.Assert(t, client.Exec(context.Background(), &testCommand{"test.Command"}) == nil)
+	assert.Assert(t, fetches == 2)
+	assert.Assert(t, attempts == 2)
+
+	// refreshed token no longer valid either => no infinite refreshing
+	validToken = "nothing-we-have"
+	assert.Assert(t, ErrorIs(client.Exec(context.Background(), &testCommand{"test.Command"}), "unauthorized"))
+	assert.Assert(t, fetches == 3)
+	assert.Assert(t, attempts == 4)
+}
+
+func TestRefreshingTokenSingleFlight(t *testing.T) {
+	fetchStarted := make(chan struct{})
+	releaseFetch := make(chan struct{})
+	fetches := int32(0)
+
+	auth := RefreshingToken(func(_ context.Context) (string, time.Time, error) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			close(fetchStarted)
+		}
+		<-releaseFetch
+		return "token", time.Now().Add(time.Hour), nil
+	})
+
+	applied := make(chan string)
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if err := auth.Apply(context.Background(), req); err != nil {
+			panic(err)
+		}
+		applied <- req.Header.Get("Authorization")
+	}()
+
+	<-fetchStarted
+
+	// waiting for the in-flight fetch respects our ctx
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := auth.Refresh(ctx)
+	assert.Assert(t, err == context.DeadlineExceeded)
+
+	waited := make(chan error)
+	go func() {
+		_, err := auth.Refresh(context.Background())
+		waited <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond) // let it join the in-flight fetch
+	close(releaseFetch)
+
+	assert.EqualString(t, <-applied, "Bearer token")
+	assert.Assert(t, <-waited == nil)
+	assert.Assert(t, atomic.LoadInt32(&fetches) == 1)
+}
+
+func TestCookieJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/command/session.Login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t", Path: "/"})
+			return
+		}
+
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "s3cr3t" {
+			httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusUnauthorized, "unauthorized", ""))
+		}
+	}))
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	assert.Assert(t, err == nil)
+
+	loginClient := New(server.URL+"/command/", "", nil, WithAuth(CookieJar(jar, nil)))
+
+	client := New(server.URL+"/command/", "", nil, WithAuth(CookieJar(jar, func(ctx context.Context) error {
+		return loginClient.Exec(ctx, &testCommand{"session.Login"})
+	})))
+
+	assert.Assert(t, client.Exec(context.Background(), &testCommand{"test.Command"}) == nil)
+}
+
+type testCommand struct {
+	key string
+}
+
+func (t *testCommand) Key() string             { return t.key }
+func (t *testCommand) Validate() error         { return nil }
+func (t *testCommand) MiddlewareChain() string { return "public" }
@@ -0,0 +1,206 @@
+package httpcommandclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/function61/eventkit/command"
+	"github.com/function61/eventkit/httpcommand"
+	"github.com/function61/gokit/os/osutil"
+)
+
+// command waiting in the outbox to be sent
+type QueuedCommand struct {
+	IdempotencyKey string          `json:"idempotency_key"`
+	Command        string          `json:"command"` // Command.Key()
+	Payload        json.RawMessage `json:"payload"`
+	Queued         time.Time       `json:"queued"`
+}
+
+// called when the server rejects a queued command (a 4xx about the command itself, e.g.
+// validation failure). the command is dropped from the outbox (retrying it wouldn't help)
+// and flushing continues with the next one.
+type FailureHandler func(item QueuedCommand, err error)
+
+// durable client-side queue for when the server isn't always reachable (e.g. laptops in
+// the field). commands are persisted to a local file and sent in order by Flush().
+//
+// if we crash after the server got a command but before we removed it from the file, the
+// command is sent again on next flush with the same idempotency key, so enable
+// httpcommand.DeduplicateWith() on the server to not have it applied twice.
+type Outbox struct {
+	client    *Client
+	path      string
+	onFailure FailureHandler
+	fileMu    sync.Mutex // guards the file
+	flushMu   sync.Mutex // only one flush at a time, so items aren't sent out of order
+}
+
+func NewOutbox(client *Client, path string, onFailure FailureHandler) *Outbox {
+	return &Outbox{
+		client:    client,
+		path:      path,
+		onFailure: onFailure,
+	}
+}
+
+// validates command and persists it to the outbox. the command is sent on next Flush()
+func (o *Outbox) Exec(cmdStruct command.Command) error {
+	if err := cmdStruct.Validate(); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(cmdStruct)
+	if err != nil {
+		return err
+	}
+
+	idempotencyKey, err := newIdempotencyKey()
+	if err != nil {
+		return err
+	}
+
+	o.fileMu.Lock()
+	defer o.fileMu.Unlock()
+
+	items, err := o.loadLocked()
+	if err != nil {
+		return err
+	}
+
+	return o.saveLocked(append(items, QueuedCommand{
+		IdempotencyKey: idempotencyKey,
+		Command:        cmdStruct.Key(),
+		Payload:        payload,
+		Queued:         time.Now().UTC(),
+	}))
+}
+
+// commands not yet sent, oldest first
+func (o *Outbox) Pending() ([]QueuedCommand, error) {
+	o.fileMu.Lock()
+	defer o.fileMu.Unlock()
+
+	return o.loadLocked()
+}
+
+// sends queued commands in order. stops at the first failure that isn't the server rejecting
+// the command (server unreachable, authentication failing etc.) and returns it, keeping the
+// command queued so that later commands don't overtake it.
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.flushMu.Lock()
+	defer o.flushMu.Unlock()
+
+	for {
+		pending, err := o.Pending()
+		if err != nil {
+			return err
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		item := pending[0]
+
+		_, errSend := o.client.execWithRetries(ctx, item.Command, item.Payload, item.IdempotencyKey)
+		if errSend != nil {
+			if !isRejection(errSend) || ctx.Err() != nil {
+				return errSend
+			}
+
+			if o.onFailure != nil {
+				o.onFailure(item, errSend)
+			}
+		}
+
+		if err := o.remove(item.IdempotencyKey); err != nil {
+			return err
+		}
+	}
+}
+
+// flushes on an interval until ctx is cancelled. transient failures are silently retried on
+// next round, which is the whole point of the outbox
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_ = o.Flush(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// server looked at the command and said no. auth problems aren't about the command, so they'd
+// get fixed by e.g. logging in again
+func isRejection(err error) bool {
+	var httpErr *httpcommand.HttpError
+	if !errors.As(err, &httpErr) || isTransient(err) {
+		return false
+	}
+
+	switch httpErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout:
+		return false
+	default:
+		return httpErr.StatusCode >= 400 && httpErr.StatusCode < 500
+	}
+}
+
+func (o *Outbox) remove(idempotencyKey string) error {
+	o.fileMu.Lock()
+	defer o.fileMu.Unlock()
+
+	items, err := o.loadLocked()
+	if err != nil {
+		return err
+	}
+
+	remaining := []QueuedCommand{}
+	for _, item := range items {
+		if item.IdempotencyKey != idempotencyKey {
+			remaining = append(remaining, item)
+		}
+	}
+
+	return o.saveLocked(remaining)
+}
+
+func (o *Outbox) loadLocked() ([]QueuedCommand, error) {
+	items := []QueuedCommand{}
+
+	content, err := ioutil.ReadFile(o.path)
+	if err != nil {
+		if os.IsNotExist(err) { // nothing queued yet
+			return items, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// atomic so a crash mid-write can't corrupt the queue
+func (o *Outbox) saveLocked(items []QueuedCommand) error {
+	return osutil.WriteFileAtomic(o.path, func(file io.Writer) error {
+		return json.NewEncoder(file).Encode(items)
+	})
+}
@@ -0,0 +1,144 @@
+package httpcommandclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/function61/eventkit/httpcommand"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "outbox")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(tempDir)
+
+	serverUp := false
+	received := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !serverUp {
+			httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusBadGateway, "down", ""))
+			return
+		}
+
+		received = append(received, r.URL.Path)
+
+		if r.URL.Path == "/command/rejected.Command" {
+			httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusBadRequest, "command_failed", "nope"))
+		}
+	}))
+	defer server.Close()
+
+	failures := []string{}
+
+	outbox := NewOutbox(New(server.URL+"/command/", "", nil), filepath.Join(tempDir, "outbox.json"), func(item QueuedCommand, err error) {
+		failures = append(failures, item.Command+": "+err.Error())
+	})
+
+	assert.Assert(t, outbox.Exec(&testCommand{"first.Command"}) == nil)
+	assert.Assert(t, outbox.Exec(&testCommand{"rejected.Command"}) == nil)
+	assert.Assert(t, outbox.Exec(&testCommand{"third.Command"}) == nil)
+
+	assert.EqualString(t, outbox.Flush(context.Background()).Error(), "down")
+
+	pending, err := outbox.Pending()
+	assert.Assert(t, err == nil)
+	assert.Assert(t, len(pending) == 3)
+
+	serverUp = true
+
+	assert.Assert(t, outbox.Flush(context.Background()) == nil)
+
+	assert.Assert(t, len(received) == 3)
+	assert.EqualString(t, received[0], "/command/first.Command")
+	assert.EqualString(t, received[1], "/command/rejected.Command")
+	assert.EqualString(t, received[2], "/command/third.Command")
+
+	assert.Assert(t, len(failures) == 1)
+	assert.EqualString(t, failures[0], "rejected.Command: command_failed: nope")
+
+	pending, err = outbox.Pending()
+	assert.Assert(t, err == nil)
+	assert.Assert(t, len(pending) == 0)
+}
+
+func TestOutboxKeepsCommandsOnAuthFailures(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "outbox")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(tempDir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusUnauthorized, "unauthorized", ""))
+	}))
+	defer server.Close()
+
+	failures := 0
+	onFailure := func(_ QueuedCommand, _ error) {
+		failures++
+	}
+
+	unauthorized := NewOutbox(New(server.URL+"/command/", "", nil), filepath.Join(tempDir, "outbox.json"), onFailure)
+
+	assert.Assert(t, unauthorized.Exec(&testCommand{"first.Command"}) == nil)
+	assert.Assert(t, unauthorized.Exec(&testCommand{"second.Command"}) == nil)
+
+	assert.Assert(t, ErrorIs(unauthorized.Flush(context.Background()), "unauthorized"))
+
+	tokenUnavailable := NewOutbox(New(server.URL+"/command/", "", nil, WithAuth(RefreshingToken(func(_ context.Context) (string, time.Time, error) {
+		return "", time.Time{}, errors.New("identity provider down")
+	}))), filepath.Join(tempDir, "outbox.json"), onFailure)
+
+	assert.EqualString(t, tokenUnavailable.Flush(context.Background()).Error(), "identity provider down")
+
+	pending, err := unauthorized.Pending()
+	assert.Assert(t, err == nil)
+	assert.Assert(t, len(pending) == 2)
+	assert.Assert(t, failures == 0)
+}
+
+func TestOutboxKeepsCommandsOnConflict(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "outbox")
+	assert.Assert(t, err == nil)
+	defer os.RemoveAll(tempDir)
+
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+
+		if attempts == 1 { // lost a race with a concurrent writer
+			httpcommand.WriteError(w, httpcommand.NewHttpError(http.StatusConflict, "event_append_conflict", ""))
+		}
+	}))
+	defer server.Close()
+
+	failures := 0
+
+	outbox := NewOutbox(New(server.URL+"/command/", "", nil), filepath.Join(tempDir, "outbox.json"), func(_ QueuedCommand, _ error) {
+		failures++
+	})
+
+	assert.Assert(t, outbox.Exec(&testCommand{"test.Command"}) == nil)
+
+	assert.Assert(t, ErrorIs(outbox.Flush(context.Background()), "event_append_conflict"))
+
+	pending, err := outbox.Pending()
+	assert.Assert(t, err == nil)
+	assert.Assert(t, len(pending) == 1)
+
+	assert.Assert(t, outbox.Flush(context.Background()) == nil)
+
+	pending, err = outbox.Pending()
+	assert.Assert(t, err == nil)
+	assert.Assert(t, len(pending) == 0)
+	assert.Assert(t, attempts == 2)
+	assert.Assert(t, failures == 0)
+}
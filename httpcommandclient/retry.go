@@ -0,0 +1,142 @@
+package httpcommandclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/function61/eventkit/httpcommand"
+)
+
+// network errors, 5xx/429 responses and 409 "idempotency_key_in_flight" (an earlier attempt is
+// still being processed) or "event_append_conflict" (server ran out of its own conflict
+// retries) are retried with exponential backoff. the server can override the
+// backoff with Retry-After header, but if it asks to wait longer than MaxBackoff we give up.
+//
+// there is no separate overall timeout: give the context a deadline. retrying stops when
+// waiting for the next attempt would go past the deadline.
+type RetryPolicy struct {
+	MaxAttempts    int           // includes the first attempt
+	InitialBackoff time.Duration // doubled for each retry
+	MaxBackoff     time.Duration
+}
+
+var noRetries = RetryPolicy{MaxAttempts: 1}
+
+// sensible default for background jobs: ~ 0.5s, 1s, 2s, 4s, 8s, 10s
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    7,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+}
+
+func WithRetries(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+func (c *Client) execWithRetries(
+	ctx context.Context,
+	commandName string,
+	body []byte,
+	idempotencyKey string,
+) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := c.execOnce(ctx, commandName, body, idempotencyKey)
+		if err == nil {
+			return res, nil
+		}
+
+		if attempt >= c.retryPolicy.MaxAttempts || !isTransient(err) {
+			return nil, err
+		}
+
+		wait := c.retryPolicy.backoff(attempt)
+		if retryAfter, ok := parseRetryAfter(res); ok {
+			if c.retryPolicy.MaxBackoff > 0 && retryAfter > c.retryPolicy.MaxBackoff {
+				return nil, err // server is down for longer than we're willing to block
+			}
+
+			wait = retryAfter
+		}
+
+		if deadline, hasDeadline := ctx.Deadline(); hasDeadline && time.Now().Add(wait).After(deadline) {
+			return nil, err // no point in waiting, since the next attempt wouldn't have time
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// whether retrying the same request could succeed
+func isTransient(err error) bool {
+	var httpErr *httpcommand.HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr.IsServerError() ||
+			httpErr.StatusCode == http.StatusTooManyRequests ||
+			httpErr.ErrorCode == "idempotency_key_in_flight" || // our earlier attempt is still being processed
+			httpErr.ErrorCode == "event_append_conflict" // lost a race with a concurrent writer
+	}
+
+	// http.Client reports all transport-level errors (connection refused, timeouts, ..) as *url.Error,
+	// but context cancellation also looks like one
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// attempt is 1-based. jitter in [50 %, 100 %] so clients failing at the same time spread out
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := float64(r.InitialBackoff) * math.Pow(2, float64(attempt-1))
+	if r.MaxBackoff > 0 && backoff > float64(r.MaxBackoff) {
+		backoff = float64(r.MaxBackoff)
+	}
+
+	return time.Duration(backoff * (0.5 + mathrand.Float64()/2))
+}
+
+// supports both forms: "120" (seconds) and "Wed, 21 Oct 2015 07:28:00 GMT"
+func parseRetryAfter(res *http.Response) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+
+	val := res.Header.Get("Retry-After")
+	if val == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(val); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(val); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func newIdempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(key), nil
+}
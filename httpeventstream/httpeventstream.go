@@ -0,0 +1,208 @@
+// Streams newly appended events to browsers with Server-Sent Events, so UIs can notice
+// changes made by other users without polling.
+package httpeventstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/function61/eventhorizon/pkg/ehevent"
+	"github.com/function61/gokit/net/http/httpauth"
+	"github.com/function61/gokit/sliceutil"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+// event at a position in the log
+type Entry struct {
+	// opaque to us. sent to the browser as SSE event ID so it comes back as Last-Event-ID
+	// when the browser reconnects. EventHorizon's cursor ("stream@version") works great.
+	Position string
+	Stream   string
+	Event    string // serialized in ehevent.Serialize() format
+}
+
+// implement on top of your event log
+type Source interface {
+	// position of the end of the log, i.e. reading after it only yields new events
+	Tail(ctx context.Context) (string, error)
+	// entries after position. if there are none, blocks until there are or ctx is cancelled
+	ReadAfter(ctx context.Context, position string) ([]Entry, error)
+}
+
+// whether the user may see the event. called for each event before it is sent
+type Authorizer func(rctx *httpauth.RequestContext, stream string, event ehevent.Event) bool
+
+type handler struct {
+	source     Source
+	eventTypes ehevent.Allocators
+	middleware httpauth.MiddlewareChain
+	authorize  Authorizer
+}
+
+// eventTypes is the generated EventTypes of the module whose events to stream. events of
+// types not in it are not sent.
+//
+// clients can narrow down with query params (comma-separated values):
+//
+//	?type=user.Created,user.Deleted&stream=/tenants/123
+func New(
+	source Source,
+	eventTypes ehevent.Allocators,
+	middleware httpauth.MiddlewareChain,
+	authorize Authorizer,
+) http.Handler {
+	return &handler{source, eventTypes, middleware, authorize}
+}
+
+// data for each SSE event
+type sentEvent struct {
+	Type                string          `json:"type"`
+	Stream              string          `json:"stream"`
+	Timestamp           time.Time       `json:"timestamp"`
+	UserId              string          `json:"user_id"`
+	ImpersonatingUserId string          `json:"impersonating_user_id,omitempty"`
+	Payload             json.RawMessage `json:"payload"`
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rctx := h.middleware(w, r)
+	if rctx == nil {
+		return // middleware dealt with error response
+	}
+
+	flusher, canFlush := w.(http.Flusher)
+	if !canFlush {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	typeFilter := commaSeparatedQueryParam(r, "type")
+	streamFilter := commaSeparatedQueryParam(r, "stream")
+
+	ctx := r.Context()
+
+	position := r.Header.Get("Last-Event-ID") // browser reconnecting => resume
+	if position == "" {
+		var err error
+		position, err = h.source.Tail(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	entries := make(chan []Entry)
+	readErr := make(chan error, 1)
+
+	go func() {
+		for {
+			batch, err := h.source.ReadAfter(ctx, position)
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			select {
+			case entries <- batch:
+			case <-ctx.Done():
+				return
+			}
+
+			if len(batch) > 0 {
+				position = batch[len(batch)-1].Position
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done(): // client went away
+			return
+		case <-readErr:
+			return // browser will reconnect with Last-Event-ID
+		case <-heartbeat.C:
+			// comment line, to keep proxies from closing idle connection
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case batch := <-entries:
+			for _, entry := range batch {
+				if err := h.sendIfVisible(w, rctx, entry, typeFilter, streamFilter); err != nil {
+					return
+				}
+			}
+
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *handler) sendIfVisible(
+	w http.ResponseWriter,
+	rctx *httpauth.RequestContext,
+	entry Entry,
+	typeFilter []string,
+	streamFilter []string,
+) error {
+	if !matchesFilter(streamFilter, entry.Stream) {
+		return nil
+	}
+
+	event, err := ehevent.Deserialize(entry.Event, h.eventTypes)
+	if err != nil {
+		return nil // not this module's event
+	}
+
+	if !matchesFilter(typeFilter, event.MetaType()) || !h.authorize(rctx, entry.Stream, event) {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	meta := event.Meta()
+
+	data, err := json.Marshal(sentEvent{
+		Type:                event.MetaType(),
+		Stream:              entry.Stream,
+		Timestamp:           meta.Timestamp,
+		UserId:              meta.UserId,
+		ImpersonatingUserId: meta.ImpersonatingUserId,
+		Payload:             payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	// JSON encoding escapes newlines, so data fits on one line
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", entry.Position, event.MetaType(), data)
+	return err
+}
+
+func commaSeparatedQueryParam(r *http.Request, key string) []string {
+	val := r.URL.Query().Get(key)
+	if val == "" {
+		return nil
+	}
+
+	return strings.Split(val, ",")
+}
+
+// empty filter matches everything
+func matchesFilter(filter []string, val string) bool {
+	return len(filter) == 0 || sliceutil.ContainsString(filter, val)
+}
@@ -0,0 +1,109 @@
+package httpeventstream
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/function61/eventhorizon/pkg/ehevent"
+	"github.com/function61/gokit/net/http/httpauth"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestStreamResumesAndFilters(t *testing.T) {
+	t0 := time.Date(2020, 2, 27, 14, 0, 0, 0, time.UTC)
+
+	source := &sliceSource{entries: []Entry{
+		entry(1, "/users", &userCreated{Name: "Joonas"}, ehevent.Meta(t0, "u1")),
+		entry(2, "/users", &userCreated{Name: "Secret"}, ehevent.Meta(t0, "u1")),
+		entry(3, "/other", &userCreated{Name: "Other stream"}, ehevent.Meta(t0, "u1")),
+		entry(4, "/users", &userCreated{Name: "Pekka"}, ehevent.Meta(t0, "u2")),
+	}}
+
+	handler := New(
+		source,
+		ehevent.Allocators{
+			"user.Created": func() ehevent.Event { return &userCreated{meta: &ehevent.EventMeta{}} },
+		},
+		func(w http.ResponseWriter, r *http.Request) *httpauth.RequestContext {
+			return &httpauth.RequestContext{}
+		},
+		func(_ *httpauth.RequestContext, _ string, event ehevent.Event) bool {
+			return event.(*userCreated).Name != "Secret"
+		})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"?stream=/users", nil)
+	assert.Assert(t, err == nil)
+	req.Header.Set("Last-Event-ID", "0")
+
+	res, err := http.DefaultClient.Do(req)
+	assert.Assert(t, err == nil)
+	defer res.Body.Close()
+
+	assert.EqualString(t, res.Header.Get("Content-Type"), "text/event-stream")
+
+	lines := bufio.NewScanner(res.Body)
+	readEvent := func() string {
+		event := []string{}
+		for lines.Scan() && lines.Text() != "" {
+			event = append(event, lines.Text())
+		}
+		return strings.Join(event, "\n")
+	}
+
+	assert.EqualString(t, readEvent(), `id: 1
+event: user.Created
+data: {"type":"user.Created","stream":"/users","timestamp":"2020-02-27T14:00:00Z","user_id":"u1","payload":{"Name":"Joonas"}}`)
+	assert.EqualString(t, readEvent(), `id: 4
+event: user.Created
+data: {"type":"user.Created","stream":"/users","timestamp":"2020-02-27T14:00:00Z","user_id":"u2","payload":{"Name":"Pekka"}}`)
+}
+
+type userCreated struct {
+	meta *ehevent.EventMeta
+	Name string
+}
+
+func (e *userCreated) MetaType() string         { return "user.Created" }
+func (e *userCreated) Meta() *ehevent.EventMeta { return e.meta }
+
+func entry(position int, stream string, event *userCreated, meta ehevent.EventMeta) Entry {
+	event.meta = &meta
+
+	return Entry{
+		Position: strconv.Itoa(position),
+		Stream:   stream,
+		Event:    ehevent.Serialize(event),
+	}
+}
+
+// positions are indexes (1-based) of entries
+type sliceSource struct {
+	entries []Entry
+}
+
+func (s *sliceSource) Tail(_ context.Context) (string, error) {
+	return strconv.Itoa(len(s.entries)), nil
+}
+
+func (s *sliceSource) ReadAfter(ctx context.Context, position string) ([]Entry, error) {
+	after, err := strconv.Atoi(position)
+	if err != nil {
+		return nil, err
+	}
+
+	if after >= len(s.entries) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return s.entries[after:], nil
+}
@@ -0,0 +1,104 @@
+// Runtime for generated typed REST clients (RestClient in restendpoints.gen.go)
+package httprestclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type Client struct {
+	baseUrl     string // looks like "http://localhost"
+	bearerToken string // optional
+	httpClient  *http.Client
+}
+
+func New(baseUrl string, bearerToken string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		baseUrl:     baseUrl,
+		bearerToken: bearerToken,
+		httpClient:  httpClient,
+	}
+}
+
+// non-2xx response
+type Error struct {
+	StatusCode  int
+	Description string // response body (truncated)
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Description)
+}
+
+// whether err is an error response with the given status, like http.StatusNotFound
+func StatusIs(err error, statusCode int) bool {
+	var restErr *Error
+	return errors.As(err, &restErr) && restErr.StatusCode == statusCode
+}
+
+// sends input (if not nil) as JSON and decodes JSON response to output (if not nil).
+// non-2xx responses are returned as *Error.
+func (c *Client) Do(ctx context.Context, method string, path string, input interface{}, output interface{}) error {
+	var body io.Reader
+	if input != nil {
+		inputJson, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(inputJson)
+	}
+
+	req, err := http.NewRequest(method, c.baseUrl+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		description, err := ioutil.ReadAll(io.LimitReader(res.Body, 4*1024))
+		if err != nil {
+			return err
+		}
+
+		return &Error{
+			StatusCode:  res.StatusCode,
+			Description: strings.TrimSpace(string(description)),
+		}
+	}
+
+	if output == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(output); err != nil {
+		return fmt.Errorf("%s %s: decoding response: %w", method, path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package httprestclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+type person struct {
+	Name string
+}
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/persons":
+			input := person{}
+			assert.Assert(t, json.NewDecoder(r.Body).Decode(&input) == nil)
+			assert.EqualString(t, r.Method, http.MethodPut)
+			assert.EqualString(t, r.Header.Get("Authorization"), "Bearer tok")
+
+			_ = json.NewEncoder(w).Encode([]person{input, {"Second"}})
+		default:
+			http.Error(w, "person not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "tok", nil)
+
+	output := []person{}
+	assert.Assert(t, client.Do(context.Background(), http.MethodPut, "/persons", person{"First"}, &output) == nil)
+	assert.Assert(t, len(output) == 2)
+	assert.EqualString(t, output[0].Name, "First")
+
+	err := client.Do(context.Background(), http.MethodGet, "/persons/123", nil, &person{})
+	assert.EqualString(t, err.Error(), "404 Not Found: person not found")
+	assert.Assert(t, StatusIs(err, http.StatusNotFound))
+}